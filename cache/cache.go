@@ -0,0 +1,63 @@
+// Package cache stores rendered tiles.
+package cache
+
+import (
+	"errors"
+	"image/color"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for tiles that are not in the cache.
+	ErrNotFound = errors.New("cache: tile not found")
+	// ErrStale is returned together with the data of tiles that are older than the TTL
+	// of the cache, so that they can be served while a fresh tile is rendered.
+	ErrStale = errors.New("cache: tile is stale")
+)
+
+// Key identifies a tile. y counts from the north like in XYZ tile URLs.
+type Key struct {
+	Z, X, Y int
+	// Format is the Mapnik image format, e.g. png256.
+	Format string
+	// Scale is the scale factor of the tile. 0 is the same as 1.
+	Scale float64
+}
+
+// String returns the key as z/x/y[@scale].format, e.g. 12/2200/1343@2x.png256.
+func (k Key) String() string {
+	s := strconv.Itoa(k.Z) + "/" + strconv.Itoa(k.X) + "/" + strconv.Itoa(k.Y)
+	if k.Scale != 0 && k.Scale != 1 {
+		s += "@" + strconv.FormatFloat(k.Scale, 'f', -1, 64) + "x"
+	}
+	return s + "." + k.Format
+}
+
+// Info describes a cached tile.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+	// Stale is true if the tile is older than the TTL of the cache.
+	Stale bool
+}
+
+// TileCache stores tiles. Implementations are safe for concurrent use.
+type TileCache interface {
+	// Get returns the tile, ErrNotFound if it is not cached, or the tile and ErrStale.
+	Get(k Key) ([]byte, error)
+	// Put stores the tile, replacing an existing tile.
+	Put(k Key, data []byte) error
+	// Delete removes the tile. Deleting a missing tile is not an error.
+	Delete(k Key) error
+	// Stat returns information about the tile or ErrNotFound.
+	Stat(k Key) (Info, error)
+}
+
+// SolidCache is implemented by caches that store identical blank and single color tiles once,
+// e.g. ocean tiles, and reference them for each tile.
+type SolidCache interface {
+	TileCache
+	// PutSolid stores the tile k with the single color c. data is the encoded tile.
+	PutSolid(k Key, c color.NRGBA, data []byte) error
+}
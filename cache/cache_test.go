@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	for _, tt := range []struct {
+		key      Key
+		expected string
+	}{
+		{Key{Z: 12, X: 2200, Y: 1343, Format: "png256"}, "12/2200/1343.png256"},
+		{Key{Z: 12, X: 2200, Y: 1343, Format: "png256", Scale: 1}, "12/2200/1343.png256"},
+		{Key{Z: 0, X: 0, Y: 0, Format: "jpeg80", Scale: 2}, "0/0/0@2x.jpeg80"},
+		{Key{Z: 0, X: 0, Y: 0, Format: "png", Scale: 1.5}, "0/0/0@1.5x.png"},
+	} {
+		if s := tt.key.String(); s != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, s)
+		}
+	}
+}
+
+func TestDisk(t *testing.T) {
+	for _, layout := range []Layout{XYZ, Hashed} {
+		d := NewDisk(t.TempDir(), layout, time.Hour)
+		k := Key{Z: 3, X: 4, Y: 5, Format: "png", Scale: 2}
+
+		if _, err := d.Get(k); err != ErrNotFound {
+			t.Error("expected ErrNotFound, got", err)
+		}
+		if _, err := d.Stat(k); err != ErrNotFound {
+			t.Error("expected ErrNotFound, got", err)
+		}
+		if err := d.Put(k, []byte("tile")); err != nil {
+			t.Fatal(err)
+		}
+		data, err := d.Get(k)
+		if err != nil || string(data) != "tile" {
+			t.Error("unexpected tile", data, err)
+		}
+		info, err := d.Stat(k)
+		if err != nil || info.Size != 4 || info.Stale {
+			t.Error("unexpected info", info, err)
+		}
+
+		// no temporary files are left behind
+		files, _ := filepath.Glob(filepath.Join(filepath.Dir(d.Path(k)), "*"))
+		if len(files) != 1 {
+			t.Error("unexpected files", files)
+		}
+
+		old := time.Now().Add(-2 * time.Hour)
+		if err := os.Chtimes(d.Path(k), old, old); err != nil {
+			t.Fatal(err)
+		}
+		data, err = d.Get(k)
+		if err != ErrStale || string(data) != "tile" {
+			t.Error("expected stale tile, got", data, err)
+		}
+		if info, _ := d.Stat(k); !info.Stale {
+			t.Error("tile not stale", info)
+		}
+
+		if err := d.Delete(k); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Delete(k); err != nil {
+			t.Error("deleting a missing tile returned", err)
+		}
+		if _, err := d.Get(k); err != ErrNotFound {
+			t.Error("expected ErrNotFound, got", err)
+		}
+	}
+
+	d := NewDisk("/tiles", XYZ, 0)
+	if p := d.Path(Key{Z: 1, X: 2, Y: 3, Format: "png"}); p != filepath.FromSlash("/tiles/1/2/3.png") {
+		t.Error("unexpected path", p)
+	}
+}
+
+func TestDiskPutSolid(t *testing.T) {
+	d := NewDisk(t.TempDir(), XYZ, 0)
+	blue := color.NRGBA{0, 0, 255, 255}
+	keys := []Key{{Z: 1, X: 0, Y: 0, Format: "png"}, {Z: 1, X: 1, Y: 0, Format: "png"}}
+	for _, k := range keys {
+		if err := d.PutSolid(k, blue, []byte("blue")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// replaces an existing tile
+	if err := d.Put(keys[0], []byte("tile")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutSolid(keys[0], blue, []byte("blue")); err != nil {
+		t.Fatal(err)
+	}
+
+	solid, err := os.Stat(d.SolidPath(keys[0], blue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		if data, err := d.Get(k); err != nil || string(data) != "blue" {
+			t.Error("unexpected tile", data, err)
+		}
+		if fi, err := os.Stat(d.Path(k)); err != nil || !os.SameFile(fi, solid) {
+			t.Error("tile not linked to solid tile", k, err)
+		}
+	}
+
+	if err := d.Delete(keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := d.Get(keys[1]); err != nil || string(data) != "blue" {
+		t.Error("deleting a tile removed the solid tile", data, err)
+	}
+	if p := d.SolidPath(Key{Format: "png256", Scale: 2}, color.NRGBA{}); p != filepath.Join(d.Dir, "solid", "00000000@2x.png256") {
+		t.Error("unexpected solid path", p)
+	}
+}
+
+func TestDiskPutSolidTTL(t *testing.T) {
+	d := NewDisk(t.TempDir(), XYZ, time.Hour)
+	blue := color.NRGBA{0, 0, 255, 255}
+	old, fresh := Key{Z: 1, X: 0, Y: 0, Format: "png"}, Key{Z: 1, X: 1, Y: 0, Format: "png"}
+	if err := d.PutSolid(old, blue, []byte("blue")); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(d.SolidPath(old, blue), past, past); err != nil {
+		t.Fatal(err)
+	}
+	// a new tile does not renew the stale tile linked to the same file
+	if err := d.PutSolid(fresh, blue, []byte("blue")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := d.Stat(old); err != nil || !info.Stale {
+		t.Error("stale tile renewed", info, err)
+	}
+	if info, err := d.Stat(fresh); err != nil || info.Stale {
+		t.Error("new tile is stale", info, err)
+	}
+}
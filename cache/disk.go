@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Layout is the directory structure of a Disk cache.
+type Layout int
+
+const (
+	// XYZ stores tiles as Dir/z/x/y[@scale].format, e.g. 12/2200/1343@2x.png256.
+	XYZ Layout = iota
+	// Hashed stores tiles as Dir/ab/cd/abcd....format, with the SHA-1 of the key as name. It
+	// spreads tiles evenly across directories, which scales better for millions of tiles.
+	Hashed
+)
+
+// Disk caches tiles as files.
+type Disk struct {
+	// Dir is the root directory of the cache.
+	Dir    string
+	Layout Layout
+	// TTL is the age after which tiles are stale. Tiles never get stale if TTL is 0.
+	TTL time.Duration
+}
+
+// NewDisk returns a disk cache in dir.
+func NewDisk(dir string, layout Layout, ttl time.Duration) *Disk {
+	return &Disk{Dir: dir, Layout: layout, TTL: ttl}
+}
+
+// Path returns the file path of the tile.
+func (d *Disk) Path(k Key) string {
+	if d.Layout == Hashed {
+		sum := sha1.Sum([]byte(k.String()))
+		h := hex.EncodeToString(sum[:])
+		return filepath.Join(d.Dir, h[:2], h[2:4], h+"."+k.Format)
+	}
+	return filepath.Join(d.Dir, filepath.FromSlash(k.String()))
+}
+
+func (d *Disk) info(fi os.FileInfo) Info {
+	return Info{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		Stale:   d.TTL > 0 && time.Since(fi.ModTime()) > d.TTL,
+	}
+}
+
+// Get reads the tile file.
+func (d *Disk) Get(k Key) ([]byte, error) {
+	f, err := os.Open(d.Path(k))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if d.info(fi).Stale {
+		return data, ErrStale
+	}
+	return data, nil
+}
+
+// Put writes the tile to a temporary file and renames it, so that readers never see partial tiles.
+func (d *Disk) Put(k Key, data []byte) error {
+	return writeFile(d.Path(k), data)
+}
+
+// SolidPath returns the file path of the tile with the single color c that is shared by
+// all tiles of this color, format and scale.
+func (d *Disk) SolidPath(k Key, c color.NRGBA) string {
+	name := fmt.Sprintf("%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+	if k.Scale != 0 && k.Scale != 1 {
+		name += "@" + strconv.FormatFloat(k.Scale, 'f', -1, 64) + "x"
+	}
+	return filepath.Join(d.Dir, "solid", name+"."+k.Format)
+}
+
+// PutSolid hard links the tile to the shared file of its color. Linked tiles share the
+// modification time of the file, which is never changed, so a tile does not renew the others.
+// With a TTL, a new shared file is started once the file is older than half the TTL, so that
+// tiles are fresh for at least half the TTL. Falls back to Put if the file system does not
+// support hard links.
+func (d *Disk) PutSolid(k Key, c color.NRGBA, data []byte) error {
+	solid := d.SolidPath(k, c)
+	fi, err := os.Stat(solid)
+	if os.IsNotExist(err) || err == nil && d.TTL > 0 && time.Since(fi.ModTime()) > d.TTL/2 {
+		// tiles linked to a replaced file keep it and its modification time
+		if err := writeFile(solid, data); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	path := d.Path(k)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// link to a temporary name and rename, as links cannot replace existing tiles
+	tmp := filepath.Join(dir, fmt.Sprintf(".tile-%d-%d", os.Getpid(), atomic.AddUint64(&linkCount, 1)))
+	if err := os.Link(solid, tmp); err != nil {
+		return d.Put(k, data)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// linkCount makes the temporary names of concurrent links unique.
+var linkCount uint64
+
+// writeFile writes data to a temporary file and renames it to path.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".tile-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Delete removes the tile file.
+func (d *Disk) Delete(k Key) error {
+	err := os.Remove(d.Path(k))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Stat returns the size and modification time of the tile file.
+func (d *Disk) Stat(k Key) (Info, error) {
+	fi, err := os.Stat(d.Path(k))
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotFound
+	} else if err != nil {
+		return Info{}, err
+	}
+	return d.info(fi), nil
+}
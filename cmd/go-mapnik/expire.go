@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/cache"
+	"github.com/sgelb/go-mapnik/expire"
+)
+
+func expireCmd(args []string) error {
+	fs := flag.NewFlagSet("expire", flag.ExitOnError)
+	minZoom := fs.Int("minzoom", 0, "minimum zoom `level`")
+	maxZoom := fs.Int("maxzoom", 18, "maximum zoom `level`")
+	bbox := fs.String("bbox", "", "changed `minx,miny,maxx,maxy`")
+	geojson := fs.String("geojson", "", "GeoJSON `file` with changed geometries")
+	srs := fs.String("srs", "", "projection of -bbox and -geojson (default: longitude/latitude)")
+	list := fs.String("list", "", "expiry list `file` with z/x/y lines to add")
+	cacheDir := fs.String("cache", "", "delete the tiles from the disk cache in `dir`")
+	hashed := fs.Bool("hashed", false, "the disk cache uses the hashed layout")
+	format := fs.String("format", "png256", "image `format` of the cached tiles")
+	scale := fs.Float64("scale", 1, "scale `factor` of the cached tiles")
+	out := fs.String("o", "", "write the expiry list to `file` (default: stdout, if -cache is not set)")
+	fs.Parse(args)
+
+	if *bbox == "" && *geojson == "" && *list == "" {
+		fs.Usage()
+		return errors.New("one of -bbox, -geojson and -list is required")
+	}
+
+	var proj *mapnik.Projection
+	if *srs != "" {
+		var err error
+		if proj, err = mapnik.NewProjection(*srs); err != nil {
+			return err
+		}
+		defer proj.Free()
+	}
+
+	tiles := expire.New(*minZoom, *maxZoom)
+	if *bbox != "" {
+		b, err := parseBBox(*bbox)
+		if err != nil {
+			return err
+		}
+		tiles.AddBBox(b[0], b[1], b[2], b[3], proj)
+	}
+	if *geojson != "" {
+		geoms, err := readGeoJSONGeometries(*geojson)
+		if err != nil {
+			return err
+		}
+		for _, g := range geoms {
+			tiles.AddGeometry(g, proj)
+		}
+	}
+	if *list != "" {
+		f, err := os.Open(*list)
+		if err != nil {
+			return err
+		}
+		err = tiles.ReadList(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if *cacheDir != "" {
+		layout := cache.XYZ
+		if *hashed {
+			layout = cache.Hashed
+		}
+		if err := tiles.Delete(cache.NewDisk(*cacheDir, layout, 0), *format, *scale); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "deleted %d tiles\n", tiles.Len())
+	}
+
+	var w io.Writer
+	var f *os.File
+	if *out != "" {
+		var err error
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		// closes the file on errors, the close error is checked below
+		defer f.Close()
+		w = f
+	} else if *cacheDir == "" {
+		w = os.Stdout
+	}
+	if w == nil {
+		return nil
+	}
+	if err := tiles.WriteList(w); err != nil {
+		return err
+	}
+	if f != nil {
+		return f.Close()
+	}
+	return nil
+}
+
+// readGeoJSONGeometries returns the geometries of a GeoJSON FeatureCollection, Feature or geometry.
+func readGeoJSONGeometries(path string) ([]mapnik.Geometry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var obj struct {
+		Type     string
+		Geometry json.RawMessage
+		Features []struct {
+			Geometry json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var raw []json.RawMessage
+	switch obj.Type {
+	case "FeatureCollection":
+		for _, f := range obj.Features {
+			raw = append(raw, f.Geometry)
+		}
+	case "Feature":
+		raw = append(raw, obj.Geometry)
+	default:
+		raw = append(raw, b)
+	}
+
+	var geoms []mapnik.Geometry
+	for _, r := range raw {
+		if len(r) == 0 || string(r) == "null" {
+			continue
+		}
+		g, err := mapnik.UnmarshalGeoJSON(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		geoms = append(geoms, g)
+	}
+	return geoms, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/export"
+)
+
+func exportCmd(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	mapFile := fs.String("map", "", "Mapnik XML `file`")
+	layer := fs.String("layer", "", "`name` of the layer")
+	bbox := fs.String("bbox", "", "only export features within `minx,miny,maxx,maxy` in the projection of the map")
+	filter := fs.String("filter", "", "Mapnik filter `expression`, e.g. \"[type] = 'park'\"")
+	srs := fs.String("srs", "", "projection of the exported geometries (default: WGS84 for geojson and ndjson, the projection of the map otherwise)")
+	format := fs.String("format", "geojson", "output `format`: geojson, ndjson, csv or wkb")
+	out := fs.String("o", "", "output `file` (default: stdout)")
+	fs.Parse(args)
+
+	if *mapFile == "" || *layer == "" {
+		fs.Usage()
+		return errors.New("-map and -layer are required")
+	}
+	f, err := export.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	q := mapnik.LayerQuery{Filter: *filter, SRS: *srs}
+	if q.SRS == "" && (f == export.GeoJSON || f == export.NDJSON) {
+		q.SRS = mapnik.WGS84
+	}
+	if *bbox != "" {
+		if q.BBox, err = parseBBox(*bbox); err != nil {
+			return err
+		}
+	}
+
+	m := mapnik.New()
+	defer m.Free()
+	if err := m.Load(*mapFile); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if *out != "" {
+		if file, err = os.Create(*out); err != nil {
+			return err
+		}
+		// closes the file on errors, the close error is checked below
+		defer file.Close()
+		w = file
+	}
+	if err := export.Layer(w, m, *layer, q, f); err != nil {
+		return err
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
+
+func parseBBox(s string) (*[4]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid bbox %q", s)
+	}
+	var bbox [4]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bbox %q", s)
+		}
+		bbox[i] = v
+	}
+	return &bbox, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+func lintCmd(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go-mapnik lint file...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no stylesheets")
+	}
+
+	failed := 0
+	for _, file := range fs.Args() {
+		m := mapnik.New()
+		err := m.LoadWith(file, mapnik.LoadOptions{Strict: true})
+		m.Free()
+		if err == nil {
+			continue
+		}
+		failed++
+		if le, ok := err.(*mapnik.LoadError); ok {
+			for _, p := range le.Problems {
+				if p.Line > 0 {
+					fmt.Printf("%s:%d: %s\n", file, p.Line, p.Message)
+				} else {
+					fmt.Printf("%s: %s\n", file, p.Message)
+				}
+			}
+		} else {
+			fmt.Printf("%s: %s\n", file, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d stylesheets have problems", failed, fs.NArg())
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Command go-mapnik provides command line tools on top of the mapnik package.
+//
+// Usage:
+//
+//	go-mapnik <command> [flags]
+//
+// Commands:
+//
+//	export    write the features of a map layer as GeoJSON, NDJSON, CSV or WKB
+//	seed      pre-render raster tiles into a directory or an MBTiles file
+//	expire    list or delete the cached tiles affected by changed geometries
+//	lint      check stylesheets and list all problems with their line
+//	serve     serve raster tiles over HTTP
+//	tilejson  write the TileJSON or WMTS capabilities of a map
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+var commands = map[string]func(args []string) error{
+	"export":   exportCmd,
+	"seed":     seedCmd,
+	"expire":   expireCmd,
+	"lint":     lintCmd,
+	"serve":    serveCmd,
+	"tilejson": tilejsonCmd,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: go-mapnik <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+name)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "go-mapnik "+os.Args[1]+":", err)
+		os.Exit(1)
+	}
+}
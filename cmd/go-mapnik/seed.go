@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/mbtiles"
+	"github.com/sgelb/go-mapnik/seed"
+)
+
+func seedCmd(args []string) (err error) {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	mapFile := fs.String("map", "", "Mapnik XML `file`")
+	minZoom := fs.Int("minzoom", 0, "minimum zoom `level`")
+	maxZoom := fs.Int("maxzoom", 5, "maximum zoom `level`")
+	bbox := fs.String("bbox", "", "only seed tiles within `minlon,minlat,maxlon,maxlat`")
+	polygon := fs.String("polygon", "", "only seed tiles intersecting the GeoJSON polygon in `file`")
+	workers := fs.Int("workers", 0, "number of rendering maps (default: number of CPUs)")
+	format := fs.String("format", "png256", "image `format`")
+	scale := fs.Float64("scale", 1, "scale `factor`, e.g. 2 for retina tiles")
+	resume := fs.Bool("resume", false, "skip tiles that are already stored")
+	shareSolid := fs.Bool("share-solid", false, "store blank and single color tiles once in output directories")
+	out := fs.String("o", "", "output directory, or MBTiles `file` if it ends with .mbtiles")
+	fs.Parse(args)
+
+	if *mapFile == "" || *out == "" {
+		fs.Usage()
+		return errors.New("-map and -o are required")
+	}
+
+	opts := seed.Options{
+		MinZoom: *minZoom,
+		MaxZoom: *maxZoom,
+		Workers: *workers,
+		NewMap: func() (*mapnik.Map, error) {
+			m := mapnik.New()
+			if err := m.Load(*mapFile); err != nil {
+				m.Free()
+				return nil, err
+			}
+			return m, nil
+		},
+		RenderOpts: mapnik.RenderOpts{Format: *format, ScaleFactor: *scale},
+		Resume:     *resume,
+		ShareSolid: *shareSolid,
+		Progress: func(p seed.Progress) {
+			fmt.Fprintf(os.Stderr, "\r%s", p)
+		},
+	}
+	if *bbox != "" {
+		if opts.BBox, err = parseBBox(*bbox); err != nil {
+			return err
+		}
+	}
+	if *polygon != "" {
+		b, err := ioutil.ReadFile(*polygon)
+		if err != nil {
+			return err
+		}
+		if opts.Polygon, err = mapnik.UnmarshalGeoJSON(b); err != nil {
+			return err
+		}
+	}
+
+	ext := tileExt(*format)
+	var store seed.Store
+	if strings.HasSuffix(*out, ".mbtiles") {
+		var s *seed.MBTilesStore
+		if s, err = seed.NewMBTilesStore(*out); err != nil {
+			return err
+		}
+		// Close commits the tiles
+		defer func() {
+			if cerr := s.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		md := mbtiles.Metadata{
+			Name:    strings.TrimSuffix(filepath.Base(*out), ".mbtiles"),
+			Format:  ext,
+			Type:    "baselayer",
+			Bounds:  [4]float64{-180, -mapnik.MaxLat, 180, mapnik.MaxLat},
+			MinZoom: *minZoom,
+			MaxZoom: *maxZoom,
+		}
+		if opts.BBox != nil {
+			md.Bounds = *opts.BBox
+		}
+		if err := s.SetMetadata(md); err != nil {
+			return err
+		}
+		store = s
+	} else {
+		store = &seed.DirStore{Dir: *out, Ext: ext}
+	}
+
+	// stop on interrupt, the run can be continued with -resume
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	p, err := seed.Seed(ctx, store, opts)
+	fmt.Fprintln(os.Stderr)
+	for i, z := range p.Zooms {
+		fmt.Fprintf(os.Stderr, "zoom %2d: %d/%d tiles, %d rendered, %d skipped, %d failed, %d bytes\n",
+			*minZoom+i, z.Done(), z.Total, z.Rendered, z.Skipped, z.Failed, z.Bytes)
+	}
+	return err
+}
+
+// tileExt returns the file extension of a Mapnik image format like png256 or jpeg80.
+func tileExt(format string) string {
+	switch {
+	case strings.HasPrefix(format, "png"):
+		return "png"
+	case strings.HasPrefix(format, "jpeg"):
+		return "jpg"
+	case strings.HasPrefix(format, "webp"):
+		return "webp"
+	case strings.HasPrefix(format, "tif"):
+		return "tif"
+	}
+	return format
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/cache"
+	"github.com/sgelb/go-mapnik/tileserver"
+)
+
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	mapFile := fs.String("map", "", "Mapnik XML `file`")
+	addr := fs.String("addr", ":8080", "listen `address`")
+	pool := fs.Int("pool", 0, "number of rendering maps (default: number of CPUs)")
+	metaTile := fs.Int("metatile", 4, "render `n`x`n` tiles at once, a power of two")
+	maxZoom := fs.Int("maxzoom", 20, "maximum zoom `level`")
+	cacheDir := fs.String("cache", "", "tile cache `directory`")
+	hashed := fs.Bool("hashed", false, "cache uses the hashed layout")
+	ttl := fs.Duration("ttl", 0, "age after which cached tiles are rendered again (default: never)")
+	fs.Parse(args)
+
+	if *mapFile == "" {
+		fs.Usage()
+		return errors.New("-map is required")
+	}
+
+	opts := tileserver.Options{
+		NewMap: func() (*mapnik.Map, error) {
+			m := mapnik.New()
+			if err := m.Load(*mapFile); err != nil {
+				m.Free()
+				return nil, err
+			}
+			return m, nil
+		},
+		PoolSize: *pool,
+		MetaTile: *metaTile,
+		MaxZoom:  *maxZoom,
+	}
+	if *cacheDir != "" {
+		layout := cache.XYZ
+		if *hashed {
+			layout = cache.Hashed
+		}
+		opts.Cache = cache.NewDisk(*cacheDir, layout, *ttl)
+		// lock metatiles for other servers sharing the cache directory
+		opts.Locker = &tileserver.FileLocker{Dir: filepath.Join(*cacheDir, ".locks")}
+	}
+	s, err := tileserver.New(opts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	fmt.Fprintf(os.Stderr, "serving tiles at http://%s/{z}/{x}/{y}.png\n", *addr)
+	return http.ListenAndServe(*addr, s)
+}
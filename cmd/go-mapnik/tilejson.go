@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+func tilejsonCmd(args []string) error {
+	fs := flag.NewFlagSet("tilejson", flag.ExitOnError)
+	mapFile := fs.String("map", "", "Mapnik XML `file`")
+	url := fs.String("url", "", "tile `URL` template, e.g. https://example.com/{z}/{x}/{y}.png")
+	wmts := fs.Bool("wmts", false, "write WMTS capabilities; the URL template uses {TileMatrix}, {TileCol} and {TileRow}")
+	layer := fs.String("layer", "", "WMTS layer `identifier` (default: name parameter of the map)")
+	fs.Parse(args)
+
+	if *mapFile == "" || *url == "" {
+		fs.Usage()
+		return errors.New("-map and -url are required")
+	}
+
+	m := mapnik.New()
+	defer m.Free()
+	if err := m.Load(*mapFile); err != nil {
+		return err
+	}
+
+	if *wmts {
+		b, err := m.WMTSCapabilities(mapnik.WMTSOptions{Layer: *layer, URL: *url})
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	tj, err := m.TileJSON(*url)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tj)
+}
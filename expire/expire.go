@@ -0,0 +1,257 @@
+// Package expire computes the tiles affected by changed data, e.g. to delete them from a
+// tile cache after a database update.
+package expire
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/cache"
+	"github.com/sgelb/go-mapnik/internal/geom"
+)
+
+// Tile is a web mercator tile. Y counts from the north like in XYZ tile URLs.
+type Tile struct {
+	Z, X, Y int
+}
+
+func (t Tile) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y)
+}
+
+// Tiles collects the tiles affected by changes.
+type Tiles struct {
+	MinZoom, MaxZoom int
+	tiles            map[Tile]struct{}
+}
+
+// New returns an empty set of tiles for the zoom range.
+func New(minZoom, maxZoom int) *Tiles {
+	return &Tiles{MinZoom: minZoom, MaxZoom: maxZoom, tiles: map[Tile]struct{}{}}
+}
+
+// Len returns the number of tiles.
+func (t *Tiles) Len() int {
+	return len(t.tiles)
+}
+
+// Add adds a single tile.
+func (t *Tiles) Add(tile Tile) {
+	t.tiles[tile] = struct{}{}
+}
+
+// AddBBox adds all tiles intersecting the bounding box. p is the projection of the bounding
+// box, or nil for longitude/latitude.
+func (t *Tiles) AddBBox(minx, miny, maxx, maxy float64, p *mapnik.Projection) {
+	t.AddGeometry(mapnik.Polygon{{{X: minx, Y: miny}, {X: maxx, Y: miny}, {X: maxx, Y: maxy}, {X: minx, Y: maxy}, {X: minx, Y: miny}}}, p)
+}
+
+// AddGeometry adds all tiles touched by the geometry: the tiles containing points, the tiles
+// along lines, and the tiles intersecting polygons. p is the projection of the geometry, or
+// nil for longitude/latitude.
+func (t *Tiles) AddGeometry(g mapnik.Geometry, p *mapnik.Projection) {
+	toMercator := func(c mapnik.Coord) mapnik.Coord {
+		if p != nil {
+			c = p.Inverse(c)
+		}
+		return mapnik.LonLatToMercator(c)
+	}
+	toMercatorLine := func(cs []mapnik.Coord) []mapnik.Coord {
+		if p != nil {
+			// straight lines in other projections are curved in web mercator
+			cs = densify(cs)
+		}
+		return transform(cs, toMercator)
+	}
+	switch g := g.(type) {
+	case mapnik.Point:
+		t.addPoint(toMercator(mapnik.Coord(g)))
+	case mapnik.MultiPoint:
+		for _, c := range g {
+			t.addPoint(toMercator(c))
+		}
+	case mapnik.LineString:
+		t.addLine(toMercatorLine(g))
+	case mapnik.MultiLineString:
+		for _, l := range g {
+			t.addLine(toMercatorLine(l))
+		}
+	case mapnik.Polygon:
+		t.addPolygon(g, toMercatorLine)
+	case mapnik.MultiPolygon:
+		for _, pg := range g {
+			t.addPolygon(pg, toMercatorLine)
+		}
+	case mapnik.GeometryCollection:
+		for _, m := range g {
+			t.AddGeometry(m, p)
+		}
+	}
+}
+
+func transform(cs []mapnik.Coord, fn func(mapnik.Coord) mapnik.Coord) []mapnik.Coord {
+	r := make([]mapnik.Coord, len(cs))
+	for i, c := range cs {
+		r[i] = fn(c)
+	}
+	return r
+}
+
+// densifySteps is the number of parts each segment is split into by densify.
+const densifySteps = 20
+
+// densify splits each segment of the line into densifySteps parts.
+func densify(cs []mapnik.Coord) []mapnik.Coord {
+	if len(cs) < 2 {
+		return cs
+	}
+	r := make([]mapnik.Coord, 0, (len(cs)-1)*densifySteps+1)
+	for i := 1; i < len(cs); i++ {
+		a, b := cs[i-1], cs[i]
+		for j := 0; j < densifySteps; j++ {
+			f := float64(j) / densifySteps
+			r = append(r, mapnik.Coord{X: a.X + (b.X-a.X)*f, Y: a.Y + (b.Y-a.Y)*f})
+		}
+	}
+	return append(r, cs[len(cs)-1])
+}
+
+// tileRange returns the tiles of zoom level z covering the mercator bounding box.
+func tileRange(z int, minx, miny, maxx, maxy float64) (x0, y0, x1, y1 int) {
+	min := mapnik.MercatorToLonLat(mapnik.Coord{X: minx, Y: miny})
+	max := mapnik.MercatorToLonLat(mapnik.Coord{X: maxx, Y: maxy})
+	x0, y0 = mapnik.LonLatToTile(min.X, max.Y, z)
+	x1, y1 = mapnik.LonLatToTile(max.X, min.Y, z)
+	return
+}
+
+func (t *Tiles) addPoint(c mapnik.Coord) {
+	for z := t.MinZoom; z <= t.MaxZoom; z++ {
+		x, y, _, _ := tileRange(z, c.X, c.Y, c.X, c.Y)
+		t.Add(Tile{z, x, y})
+	}
+}
+
+func (t *Tiles) addLine(l []mapnik.Coord) {
+	if len(l) == 1 {
+		t.addPoint(l[0])
+	}
+	for i := 1; i < len(l); i++ {
+		a, b := l[i-1], l[i]
+		t.addMatching(math.Min(a.X, b.X), math.Min(a.Y, b.Y), math.Max(a.X, b.X), math.Max(a.Y, b.Y),
+			func(minx, miny, maxx, maxy float64) bool {
+				return geom.SegmentIntersectsBox(a, b, minx, miny, maxx, maxy)
+			})
+	}
+}
+
+func (t *Tiles) addPolygon(p mapnik.Polygon, toMercator func([]mapnik.Coord) []mapnik.Coord) {
+	if len(p) == 0 || len(p[0]) == 0 {
+		return
+	}
+	rings := make([][]mapnik.Coord, len(p))
+	for i, r := range p {
+		rings[i] = toMercator(r)
+	}
+	minx, miny := math.Inf(1), math.Inf(1)
+	maxx, maxy := math.Inf(-1), math.Inf(-1)
+	for _, c := range rings[0] {
+		minx, miny = math.Min(minx, c.X), math.Min(miny, c.Y)
+		maxx, maxy = math.Max(maxx, c.X), math.Max(maxy, c.Y)
+	}
+	t.addMatching(minx, miny, maxx, maxy, func(x0, y0, x1, y1 float64) bool {
+		// the tile is within the polygon, or an edge of the polygon crosses the tile
+		if geom.Contains(rings, mapnik.Coord{X: (x0 + x1) / 2, Y: (y0 + y1) / 2}) {
+			return true
+		}
+		for _, r := range rings {
+			for i := 1; i < len(r); i++ {
+				if geom.SegmentIntersectsBox(r[i-1], r[i], x0, y0, x1, y1) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// addMatching adds the tiles within the mercator bounding box for which match returns true.
+func (t *Tiles) addMatching(minx, miny, maxx, maxy float64, match func(minx, miny, maxx, maxy float64) bool) {
+	for z := t.MinZoom; z <= t.MaxZoom; z++ {
+		x0, y0, x1, y1 := tileRange(z, minx, miny, maxx, maxy)
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				if match(mapnik.TileBBox(z, x, y)) {
+					t.Add(Tile{z, x, y})
+				}
+			}
+		}
+	}
+}
+
+// List returns all tiles, sorted by zoom level, x and y.
+func (t *Tiles) List() []Tile {
+	list := make([]Tile, 0, len(t.tiles))
+	for tile := range t.tiles {
+		list = append(list, tile)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Z != b.Z {
+			return a.Z < b.Z
+		}
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		return a.Y < b.Y
+	})
+	return list
+}
+
+// WriteList writes one z/x/y line per tile, the expiry list format of osm2pgsql and other tools.
+func (t *Tiles) WriteList(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, tile := range t.List() {
+		fmt.Fprintln(bw, tile)
+	}
+	return bw.Flush()
+}
+
+// ReadList adds all tiles of an expiry list, ignoring tiles outside of the zoom range.
+func (t *Tiles) ReadList(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		var tile Tile
+		if _, err := fmt.Sscanf(line, "%d/%d/%d", &tile.Z, &tile.X, &tile.Y); err != nil {
+			return fmt.Errorf("expire: invalid tile %q in line %d", line, n)
+		}
+		if tile.Z >= t.MinZoom && tile.Z <= t.MaxZoom {
+			t.Add(tile)
+		}
+	}
+	return s.Err()
+}
+
+// Delete removes all tiles with the format and scale factors from the cache.
+func (t *Tiles) Delete(c cache.TileCache, format string, scales ...float64) error {
+	if len(scales) == 0 {
+		scales = []float64{1}
+	}
+	for tile := range t.tiles {
+		for _, s := range scales {
+			if err := c.Delete(cache.Key{Z: tile.Z, X: tile.X, Y: tile.Y, Format: format, Scale: s}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
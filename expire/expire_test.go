@@ -0,0 +1,123 @@
+package expire
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/cache"
+)
+
+func TestAddGeometry(t *testing.T) {
+	tests := []struct {
+		geom     mapnik.Geometry
+		expected []Tile
+	}{
+		{mapnik.Point{X: -90, Y: 45}, []Tile{{0, 0, 0}, {1, 0, 0}, {2, 1, 1}}},
+		// horizontal line through the north western and north eastern quarter
+		{mapnik.LineString{{X: -100, Y: 45}, {X: 100, Y: 45}}, []Tile{
+			{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {2, 0, 1}, {2, 1, 1}, {2, 2, 1}, {2, 3, 1},
+		}},
+		// the south eastern quarter, without tiles only touched by the edges
+		{mapnik.Polygon{{{X: 1, Y: -1}, {X: 179, Y: -1}, {X: 179, Y: -84}, {X: 1, Y: -84}, {X: 1, Y: -1}}}, []Tile{
+			{0, 0, 0}, {1, 1, 1}, {2, 2, 2}, {2, 2, 3}, {2, 3, 2}, {2, 3, 3},
+		}},
+	}
+	for _, tt := range tests {
+		tiles := New(0, 2)
+		tiles.AddGeometry(tt.geom, nil)
+		if list := tiles.List(); !reflect.DeepEqual(tt.expected, list) {
+			t.Errorf("%v: expected %v, got %v", tt.geom, tt.expected, list)
+		}
+	}
+
+	// large polygon with a hole, the tiles within the hole are not affected
+	tiles := New(3, 3)
+	tiles.AddGeometry(mapnik.Polygon{
+		{{X: -179, Y: -84}, {X: 179, Y: -84}, {X: 179, Y: 84}, {X: -179, Y: 84}, {X: -179, Y: -84}},
+		{{X: -50, Y: -50}, {X: 50, Y: -50}, {X: 50, Y: 50}, {X: -50, Y: 50}, {X: -50, Y: -50}},
+	}, nil)
+	for _, tile := range tiles.List() {
+		if (tile.X == 3 || tile.X == 4) && (tile.Y == 3 || tile.Y == 4) {
+			t.Error("tile within hole", tile)
+		}
+	}
+	if tiles.Len() != 60 {
+		t.Error("unexpected number of tiles", tiles.Len())
+	}
+}
+
+func TestList(t *testing.T) {
+	tiles := New(0, 1)
+	tiles.AddBBox(-10, -10, 10, 10, nil)
+	buf := &bytes.Buffer{}
+	if err := tiles.WriteList(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "0/0/0\n1/0/0\n1/0/1\n1/1/0\n1/1/1\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected list:\n%s", buf)
+	}
+
+	read := New(1, 1)
+	if err := read.ReadList(strings.NewReader(buf.String())); err != nil {
+		t.Fatal(err)
+	}
+	if read.Len() != 4 {
+		t.Error("unexpected tiles", read.List())
+	}
+	if err := read.ReadList(strings.NewReader("1/2\n")); err == nil {
+		t.Error("invalid list did not return an error")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c := cache.NewDisk(t.TempDir(), cache.XYZ, 0)
+	k := cache.Key{Z: 1, X: 1, Y: 0, Format: "png", Scale: 2}
+	if err := c.Put(k, []byte("tile")); err != nil {
+		t.Fatal(err)
+	}
+	tiles := New(0, 1)
+	tiles.AddGeometry(mapnik.Point{X: 90, Y: 45}, nil)
+	if err := tiles.Delete(c, "png", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(k); err != cache.ErrNotFound {
+		t.Error("tile not deleted", err)
+	}
+}
+
+func TestProjection(t *testing.T) {
+	p, err := mapnik.NewProjection(mapnik.WebMercator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Free()
+	tiles := New(2, 2)
+	c := mapnik.LonLatToMercator(mapnik.Coord{X: -90, Y: 45})
+	tiles.AddGeometry(mapnik.Point(c), p)
+	if list := tiles.List(); !reflect.DeepEqual([]Tile{{2, 1, 1}}, list) {
+		t.Error("unexpected tiles", list)
+	}
+	// the straight edges of a UTM box are curved in web mercator
+	utm, err := mapnik.NewProjection("+proj=utm +zone=32 +datum=WGS84 +units=m +no_defs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer utm.Free()
+	tiles = New(10, 10)
+	minx, miny, maxx, maxy := 100000.0, 7000000.0, 900000.0, 7400000.0
+	tiles.AddBBox(minx, miny, maxx, maxy, utm)
+	for i := 0; i <= 100; i++ {
+		x := minx + (maxx-minx)*float64(i)/100
+		for _, c := range []mapnik.Coord{{X: x, Y: miny}, {X: x, Y: maxy}} {
+			ll := utm.Inverse(c)
+			tx, ty := mapnik.LonLatToTile(ll.X, ll.Y, 10)
+			if _, ok := tiles.tiles[Tile{10, tx, ty}]; !ok {
+				t.Error("tile along the edge missing", Tile{10, tx, ty})
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package export writes features of map layers as GeoJSON, newline-delimited GeoJSON,
+// CSV with WKT geometries or CSV with hex encoded WKB geometries.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+// Format is an output format.
+type Format string
+
+const (
+	// GeoJSON writes a single FeatureCollection.
+	GeoJSON Format = "geojson"
+	// NDJSON writes one GeoJSON Feature per line.
+	NDJSON Format = "ndjson"
+	// CSV writes one row per feature with the columns id, wkt and all properties.
+	CSV Format = "csv"
+	// WKB writes CSV like the CSV format, but with the geometry as hex encoded WKB in
+	// the column wkb, as understood by PostGIS and ogr2ogr.
+	WKB Format = "wkb"
+)
+
+// Formats lists all supported formats.
+var Formats = []Format{GeoJSON, NDJSON, CSV, WKB}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("export: unknown format %q", name)
+}
+
+// Layer queries the features of a map layer and writes them to w.
+func Layer(w io.Writer, m *mapnik.Map, layer string, q mapnik.LayerQuery, format Format) error {
+	features, err := m.LayerFeatures(layer, q)
+	if err != nil {
+		return err
+	}
+	return Write(w, features, format)
+}
+
+// Write writes the features to w.
+func Write(w io.Writer, features []mapnik.Feature, format Format) error {
+	switch format {
+	case GeoJSON:
+		return WriteGeoJSON(w, features)
+	case NDJSON:
+		return WriteNDJSON(w, features)
+	case CSV:
+		return WriteCSV(w, features)
+	case WKB:
+		return WriteWKB(w, features)
+	}
+	return fmt.Errorf("export: unknown format %q", format)
+}
+
+type geojsonFeature struct {
+	Type       string                 `json:"type"`
+	ID         int64                  `json:"id"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+func marshalFeature(f mapnik.Feature) ([]byte, error) {
+	geom := json.RawMessage("null")
+	if f.Geometry != nil {
+		var err error
+		if geom, err = mapnik.MarshalGeoJSON(f.Geometry); err != nil {
+			return nil, fmt.Errorf("export: feature %d: %v", f.ID, err)
+		}
+	}
+	props := f.Properties
+	if props == nil {
+		props = map[string]interface{}{}
+	}
+	return json.Marshal(geojsonFeature{"Feature", f.ID, geom, props})
+}
+
+// WriteGeoJSON writes the features as a GeoJSON FeatureCollection.
+func WriteGeoJSON(w io.Writer, features []mapnik.Feature) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"type":"FeatureCollection","features":[`)
+	for i, f := range features {
+		b, err := marshalFeature(f)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n")
+		bw.Write(b)
+	}
+	bw.WriteString("\n]}\n")
+	return bw.Flush()
+}
+
+// WriteNDJSON writes one GeoJSON Feature per line.
+func WriteNDJSON(w io.Writer, features []mapnik.Feature) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range features {
+		b, err := marshalFeature(f)
+		if err != nil {
+			return err
+		}
+		bw.Write(b)
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes the features as CSV with the geometry as WKT.
+func WriteCSV(w io.Writer, features []mapnik.Feature) error {
+	return writeCSV(w, features, "wkt", mapnik.MarshalWKT)
+}
+
+// WriteWKB writes the features as CSV with the geometry as hex encoded WKB.
+func WriteWKB(w io.Writer, features []mapnik.Feature) error {
+	return writeCSV(w, features, "wkb", func(g mapnik.Geometry) string {
+		return hex.EncodeToString(mapnik.MarshalWKB(g))
+	})
+}
+
+// writeCSV writes a header row with id, the geometry column and the sorted names of all
+// properties, followed by one row per feature. Missing and null properties are empty.
+func writeCSV(w io.Writer, features []mapnik.Feature, geomColumn string, encode func(mapnik.Geometry) string) error {
+	seen := map[string]bool{}
+	var keys []string
+	for _, f := range features {
+		for k := range f.Properties {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"id", geomColumn}, keys...))
+	row := make([]string, len(keys)+2)
+	for _, f := range features {
+		row[0] = strconv.FormatInt(f.ID, 10)
+		row[1] = ""
+		if f.Geometry != nil {
+			row[1] = encode(f.Geometry)
+		}
+		for i, k := range keys {
+			row[i+2] = formatValue(f.Properties[k])
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
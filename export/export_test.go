@@ -0,0 +1,88 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+var testFeatures = []mapnik.Feature{
+	{ID: 1, Geometry: mapnik.Point{X: 1, Y: 2}, Properties: map[string]interface{}{"name": "a, b", "n": int64(3)}},
+	{ID: 2, Geometry: mapnik.LineString{{X: 0, Y: 0}, {X: 1.5, Y: 1}}, Properties: map[string]interface{}{"v": 0.5, "ok": true}},
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{GeoJSON, `{"type":"FeatureCollection","features":[
+{"type":"Feature","id":1,"geometry":{"type":"Point","coordinates":[1,2]},"properties":{"n":3,"name":"a, b"}},
+{"type":"Feature","id":2,"geometry":{"type":"LineString","coordinates":[[0,0],[1.5,1]]},"properties":{"ok":true,"v":0.5}}
+]}
+`},
+		{NDJSON, `{"type":"Feature","id":1,"geometry":{"type":"Point","coordinates":[1,2]},"properties":{"n":3,"name":"a, b"}}
+{"type":"Feature","id":2,"geometry":{"type":"LineString","coordinates":[[0,0],[1.5,1]]},"properties":{"ok":true,"v":0.5}}
+`},
+		{CSV, `id,wkt,n,name,ok,v
+1,POINT (1 2),3,"a, b",,
+2,"LINESTRING (0 0, 1.5 1)",,,true,0.5
+`},
+		{WKB, `id,wkb,n,name,ok,v
+1,0101000000000000000000f03f0000000000000040,3,"a, b",,
+2,01020000000200000000000000000000000000000000000000000000000000f83f000000000000f03f,,,true,0.5
+`},
+	}
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		if err := Write(buf, testFeatures, tt.format); err != nil {
+			t.Fatal(tt.format, err)
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("unexpected %s output:\n%s", tt.format, buf.String())
+		}
+	}
+
+	if _, err := ParseFormat("shp"); err == nil {
+		t.Error("unknown format did not return an error")
+	}
+}
+
+func TestLayer(t *testing.T) {
+	m := mapnik.New()
+	if err := m.Load("../test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Layer(buf, m, "layerA", mapnik.LayerQuery{}, NDJSON); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatal("unexpected features", lines)
+	}
+	var f struct {
+		Geometry struct{ Type string }
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &f); err != nil || f.Geometry.Type != "Polygon" {
+		t.Error("unexpected feature", lines[0], err)
+	}
+
+	// bbox outside of the polygon
+	buf.Reset()
+	q := mapnik.LayerQuery{BBox: &[4]float64{20, 20, 30, 30}}
+	if err := Layer(buf, m, "layerA", q, NDJSON); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Error("unexpected features outside of bbox", buf.String())
+	}
+
+	if err := Layer(buf, m, "unknown", mapnik.LayerQuery{}, CSV); err == nil {
+		t.Error("unknown layer did not return an error")
+	}
+}
@@ -0,0 +1,180 @@
+package mapnik
+
+// #include <stdlib.h>
+// #include "mapnik_c_api.h"
+import "C"
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// goStrings converts and frees a list of strings.
+func goStrings(s *C.mapnik_strings_t) []string {
+	defer C.mapnik_strings_free(s)
+	n := int(C.mapnik_strings_count(s))
+	list := make([]string, n)
+	for i := range list {
+		list[i] = C.GoString(C.mapnik_strings_get(s, C.size_t(i)))
+	}
+	return list
+}
+
+// Font is a registered font face.
+type Font struct {
+	// Face is the name used in stylesheets, e.g. "DejaVu Sans Bold".
+	Face string
+	// File is the path of the font file. Empty with Mapnik 2.
+	File string
+}
+
+// Fonts returns all registered font faces, sorted by name.
+func Fonts() []Font {
+	faces := goStrings(C.mapnik_font_faces())
+	sort.Strings(faces)
+	fonts := make([]Font, len(faces))
+	for i, face := range faces {
+		cs := C.CString(face)
+		fonts[i] = Font{Face: face}
+		if file := C.mapnik_font_file(cs); file != nil {
+			fonts[i].File = C.GoString(file)
+		}
+		C.free(unsafe.Pointer(cs))
+	}
+	return fonts
+}
+
+// RegisterFontFaces registers the fonts in path, a font file or a directory, and returns the
+// names of the newly added faces. Subdirectories are searched if recursive is true. Unlike
+// RegisterFonts, it returns an error if no new faces were found.
+func RegisterFontFaces(path string, recursive bool) ([]string, error) {
+	cs := C.CString(path)
+	defer C.free(unsafe.Pointer(cs))
+	r := 0
+	if recursive {
+		r = 1
+	}
+	s := C.mapnik_register_font_faces(cs, C.int(r))
+	if s == nil {
+		return nil, errors.New("mapnik: " + C.GoString(C.mapnik_register_last_error()))
+	}
+	faces := goStrings(s)
+	if len(faces) == 0 {
+		return nil, errors.New("mapnik: no new fonts found in " + path)
+	}
+	sort.Strings(faces)
+	return faces, nil
+}
+
+// MissingFonts returns the face names used by text and shield symbolizers and by the fontsets
+// of the map that are not registered. Labels with missing fonts are not rendered.
+// Requires Mapnik 3.
+func (m *Map) MissingFonts() ([]string, error) {
+	s := C.mapnik_map_missing_fonts(m.m)
+	if s == nil {
+		return nil, m.lastError()
+	}
+	return goStrings(s), nil
+}
+
+// SetFontDirectory registers the fonts in the directory path for this map only, so that
+// stylesheets with different font bundles can be used in one process. Subdirectories are not
+// searched, like with the font-directory attribute of stylesheets. The font directory of the
+// map is only changed if fonts were found. Mapnik 2 registers the fonts globally.
+func (m *Map) SetFontDirectory(path string) error {
+	cs := C.CString(path)
+	defer C.free(unsafe.Pointer(cs))
+	if C.mapnik_map_set_font_directory(m.m, cs) != 0 {
+		return m.lastError()
+	}
+	return nil
+}
+
+// FontDirectory returns the font directory set with SetFontDirectory or the font-directory
+// attribute of the stylesheet.
+func (m *Map) FontDirectory() string {
+	if dir := C.mapnik_map_get_font_directory(m.m); dir != nil {
+		return C.GoString(dir)
+	}
+	return ""
+}
+
+// AddFontSet adds a fontset, a list of faces that are tried in order for each character.
+// Stylesheets reference fontsets with fontset-name when they are loaded, so add fontsets before
+// Load or LoadString. Fontsets added with AddFontSet take precedence over fontsets of the same
+// name in the stylesheet.
+func (m *Map) AddFontSet(name string, faces ...string) error {
+	if len(faces) == 0 {
+		return errors.New("mapnik: fontset " + name + " without faces")
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cfaces := make([]*C.char, len(faces))
+	for i, face := range faces {
+		cfaces[i] = C.CString(face)
+		defer C.free(unsafe.Pointer(cfaces[i]))
+	}
+	if C.mapnik_map_insert_fontset(m.m, cname, &cfaces[0], C.size_t(len(faces))) != 0 {
+		return m.lastError()
+	}
+	if m.fontSets == nil {
+		m.fontSets = map[string][]string{}
+	}
+	m.fontSets[name] = append([]string(nil), faces...)
+	return nil
+}
+
+// FontSets returns the faces of all fontsets of the map by name.
+func (m *Map) FontSets() map[string][]string {
+	fontsets := map[string][]string{}
+	for _, name := range goStrings(C.mapnik_map_fontset_names(m.m)) {
+		cs := C.CString(name)
+		if s := C.mapnik_map_fontset_faces(m.m, cs); s != nil {
+			fontsets[name] = goStrings(s)
+		}
+		C.free(unsafe.Pointer(cs))
+	}
+	return fontsets
+}
+
+// withFontSets inserts FontSet elements at the start of the Map element of the stylesheet,
+// as Mapnik resolves fontset-name only against the fontsets defined in the stylesheet.
+func withFontSets(stylesheet string, fontsets map[string][]string) string {
+	d := xml.NewDecoder(strings.NewReader(stylesheet))
+	d.Strict = false
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			return stylesheet
+		}
+		if e, ok := tok.(xml.StartElement); ok && e.Name.Local == "Map" {
+			off := int(d.InputOffset())
+			if strings.HasSuffix(stylesheet[:off], "/>") {
+				// an empty map does not use fontsets
+				return stylesheet
+			}
+			names := make([]string, 0, len(fontsets))
+			for name := range fontsets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var b bytes.Buffer
+			for _, name := range names {
+				b.WriteString(`<FontSet name="`)
+				xml.EscapeText(&b, []byte(name))
+				b.WriteString(`">`)
+				for _, face := range fontsets[name] {
+					b.WriteString(`<Font face-name="`)
+					xml.EscapeText(&b, []byte(face))
+					b.WriteString(`"/>`)
+				}
+				b.WriteString(`</FontSet>`)
+			}
+			return stylesheet[:off] + b.String() + stylesheet[off:]
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package mapnik
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFonts(t *testing.T) {
+	fonts := Fonts()
+	if len(fonts) == 0 {
+		t.Skip("no fonts registered")
+	}
+	for i, f := range fonts {
+		if f.Face == "" || i > 0 && fonts[i-1].Face > f.Face {
+			t.Error("fonts not sorted", f)
+		}
+	}
+
+	// registering the same fonts again adds no faces
+	if faces, err := RegisterFontFaces(fontPath, true); err == nil {
+		t.Error("expected error for already registered fonts, got", faces)
+	}
+	if _, err := RegisterFontFaces("/nonexistent", false); err == nil {
+		t.Error("missing directory did not return an error")
+	}
+}
+
+func TestMissingFonts(t *testing.T) {
+	fonts := Fonts()
+	if len(fonts) == 0 {
+		t.Skip("no fonts registered")
+	}
+	m := New()
+	defer m.Free()
+	err := m.LoadString(`<Map>
+		<FontSet name="fallback">
+			<Font face-name="`+fonts[0].Face+`" />
+			<Font face-name="Missing Fallback Regular" />
+		</FontSet>
+		<Style name="labels">
+			<Rule>
+				<TextSymbolizer face-name="Missing Sans Regular">[name]</TextSymbolizer>
+				<TextSymbolizer fontset-name="fallback">[name]</TextSymbolizer>
+				<TextSymbolizer face-name="`+fonts[0].Face+`">[name]</TextSymbolizer>
+				<TextSymbolizer face-name="`+fonts[0].Face+`">
+					<Layout><Format face-name="Missing Format Bold">[name]</Format></Layout>
+				</TextSymbolizer>
+				<TextSymbolizer face-name="`+fonts[0].Face+`" placement-type="list">[name]
+					<Placement face-name="Missing Placement Regular"/>
+				</TextSymbolizer>
+			</Rule>
+		</Style>
+	</Map>`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := m.MissingFonts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Missing Fallback Regular", "Missing Format Bold", "Missing Placement Regular", "Missing Sans Regular"}; !reflect.DeepEqual(missing, expected) {
+		t.Errorf("expected %v, got %v", expected, missing)
+	}
+}
+
+func TestFontSets(t *testing.T) {
+	m := New()
+	defer m.Free()
+	if err := m.AddFontSet("labels", "DejaVu Sans Book", "Unifont Medium"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddFontSet("labels", "DejaVu Sans Book"); err == nil {
+		t.Error("duplicate fontset did not return an error")
+	}
+	if err := m.AddFontSet("empty"); err == nil {
+		t.Error("empty fontset did not return an error")
+	}
+	// the stylesheet references the fontset added before
+	err := m.LoadString(`<Map>
+		<Style name="labels">
+			<Rule><TextSymbolizer fontset-name="labels">[name]</TextSymbolizer></Rule>
+		</Style>
+	</Map>`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"labels": {"DejaVu Sans Book", "Unifont Medium"}}
+	if fontsets := m.FontSets(); !reflect.DeepEqual(fontsets, expected) {
+		t.Errorf("expected %v, got %v", expected, fontsets)
+	}
+
+	if err := m.SetFontDirectory("/nonexistent"); err == nil {
+		t.Error("missing directory did not return an error")
+	}
+	if dir := m.FontDirectory(); dir != "" {
+		t.Error("font directory set after an error", dir)
+	}
+
+	// fontsets of a stylesheet are not injected into other stylesheets
+	m2 := New()
+	defer m2.Free()
+	if err := m2.LoadString(`<Map><FontSet name="fs"><Font face-name="DejaVu Sans Book"/></FontSet></Map>`, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(m2.FontSets()) != 1 || len(m2.fontSets) != 0 {
+		t.Error("unexpected fontsets", m2.FontSets(), m2.fontSets)
+	}
+}
+
+func TestWithFontSets(t *testing.T) {
+	fontsets := map[string][]string{"b": {`Face "B"`}, "a": {"A1", "A2"}}
+	tests := []struct{ in, out string }{
+		{
+			`<?xml version="1.0"?><!DOCTYPE Map [<!ENTITY x "y">]><Map srs="&x;"><Layer/></Map>`,
+			`<?xml version="1.0"?><!DOCTYPE Map [<!ENTITY x "y">]><Map srs="&x;">` +
+				`<FontSet name="a"><Font face-name="A1"/><Font face-name="A2"/></FontSet>` +
+				`<FontSet name="b"><Font face-name="Face &#34;B&#34;"/></FontSet><Layer/></Map>`,
+		},
+		{`<Map/>`, `<Map/>`},
+		{`not xml`, `not xml`},
+	}
+	for _, tt := range tests {
+		if out := withFontSets(tt.in, fontsets); out != tt.out {
+			t.Errorf("expected %s, got %s", tt.out, out)
+		}
+	}
+}
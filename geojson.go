@@ -0,0 +1,189 @@
+package mapnik
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type geojsonGeometry struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates,omitempty"`
+	Geometries  []json.RawMessage `json:"geometries,omitempty"`
+}
+
+// MarshalGeoJSON encodes the geometry as a GeoJSON geometry object.
+func MarshalGeoJSON(g Geometry) ([]byte, error) {
+	if gc, ok := g.(GeometryCollection); ok {
+		geoms := make([]json.RawMessage, len(gc))
+		for i, m := range gc {
+			b, err := MarshalGeoJSON(m)
+			if err != nil {
+				return nil, err
+			}
+			geoms[i] = b
+		}
+		return json.Marshal(struct {
+			Type       string            `json:"type"`
+			Geometries []json.RawMessage `json:"geometries"`
+		}{g.Type(), geoms})
+	}
+	return json.Marshal(struct {
+		Type        string      `json:"type"`
+		Coordinates interface{} `json:"coordinates"`
+	}{g.Type(), geojsonCoordinates(g)})
+}
+
+func geojsonCoordinates(g Geometry) interface{} {
+	switch g := g.(type) {
+	case Point:
+		return geojsonPosition(Coord(g))
+	case LineString:
+		return geojsonPositions(g)
+	case MultiPoint:
+		return geojsonPositions(g)
+	case Polygon:
+		return geojsonRings(g)
+	case MultiLineString:
+		ls := make([][][2]float64, len(g))
+		for i, l := range g {
+			ls[i] = geojsonPositions(l)
+		}
+		return ls
+	case MultiPolygon:
+		ps := make([][][][2]float64, len(g))
+		for i, p := range g {
+			ps[i] = geojsonRings(p)
+		}
+		return ps
+	}
+	return nil
+}
+
+func geojsonPosition(c Coord) [2]float64 {
+	return [2]float64{c.X, c.Y}
+}
+
+func geojsonPositions(cs []Coord) [][2]float64 {
+	ps := make([][2]float64, len(cs))
+	for i, c := range cs {
+		ps[i] = geojsonPosition(c)
+	}
+	return ps
+}
+
+func geojsonRings(rings [][]Coord) [][][2]float64 {
+	rs := make([][][2]float64, len(rings))
+	for i, r := range rings {
+		rs[i] = geojsonPositions(r)
+	}
+	return rs
+}
+
+// UnmarshalGeoJSON decodes a geometry from a GeoJSON geometry object. Additional
+// dimensions of positions (e.g. elevation) are ignored.
+func UnmarshalGeoJSON(b []byte) (Geometry, error) {
+	var g geojsonGeometry
+	if err := json.Unmarshal(b, &g); err != nil {
+		return nil, fmt.Errorf("mapnik: invalid GeoJSON geometry: %v", err)
+	}
+	if g.Type == "GeometryCollection" {
+		gc := make(GeometryCollection, len(g.Geometries))
+		for i, m := range g.Geometries {
+			geom, err := UnmarshalGeoJSON(m)
+			if err != nil {
+				return nil, err
+			}
+			gc[i] = geom
+		}
+		return gc, nil
+	}
+	if g.Coordinates == nil {
+		return nil, fmt.Errorf("mapnik: GeoJSON %s without coordinates", g.Type)
+	}
+
+	var err error
+	switch g.Type {
+	case "Point":
+		var p []float64
+		if err = json.Unmarshal(g.Coordinates, &p); err == nil {
+			var c Coord
+			if c, err = coordFromPosition(p); err == nil {
+				return Point(c), nil
+			}
+		}
+	case "LineString", "MultiPoint":
+		var ps [][]float64
+		if err = json.Unmarshal(g.Coordinates, &ps); err == nil {
+			var cs []Coord
+			if cs, err = coordsFromPositions(ps); err == nil {
+				if g.Type == "MultiPoint" {
+					return MultiPoint(cs), nil
+				}
+				return LineString(cs), nil
+			}
+		}
+	case "Polygon", "MultiLineString":
+		var rs [][][]float64
+		if err = json.Unmarshal(g.Coordinates, &rs); err == nil {
+			var rings [][]Coord
+			if rings, err = ringsFromPositions(rs); err == nil {
+				if g.Type == "Polygon" {
+					return Polygon(rings), nil
+				}
+				ml := make(MultiLineString, len(rings))
+				for i, r := range rings {
+					ml[i] = r
+				}
+				return ml, nil
+			}
+		}
+	case "MultiPolygon":
+		var ps [][][][]float64
+		if err = json.Unmarshal(g.Coordinates, &ps); err == nil {
+			mp := make(MultiPolygon, len(ps))
+			for i, p := range ps {
+				if mp[i], err = ringsFromPositions(p); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				return mp, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("mapnik: unsupported GeoJSON geometry type %q", g.Type)
+	}
+	return nil, fmt.Errorf("mapnik: invalid GeoJSON %s: %v", g.Type, err)
+}
+
+func coordFromPosition(p []float64) (Coord, error) {
+	if len(p) < 2 {
+		return Coord{}, errors.New("position with less than two values")
+	}
+	return Coord{p[0], p[1]}, nil
+}
+
+func coordsFromPositions(ps [][]float64) ([]Coord, error) {
+	cs := make([]Coord, len(ps))
+	for i, p := range ps {
+		c, err := coordFromPosition(p)
+		if err != nil {
+			return nil, err
+		}
+		cs[i] = c
+	}
+	return cs, nil
+}
+
+func ringsFromPositions(rs [][][]float64) ([][]Coord, error) {
+	rings := make([][]Coord, len(rs))
+	for i, r := range rs {
+		cs, err := coordsFromPositions(r)
+		if err != nil {
+			return nil, err
+		}
+		rings[i] = cs
+	}
+	return rings, nil
+}
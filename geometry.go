@@ -0,0 +1,307 @@
+package mapnik
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Geometry is one of Point, LineString, Polygon, MultiPoint, MultiLineString, MultiPolygon
+// or GeometryCollection.
+type Geometry interface {
+	// Type returns the OGC geometry type name, e.g. "LineString".
+	Type() string
+	appendWKB(b []byte) []byte
+}
+
+// Point is a single position.
+type Point Coord
+
+// LineString is a line through two or more positions.
+type LineString []Coord
+
+// Polygon is a list of linear rings. The first ring is the exterior ring, all further rings are holes.
+type Polygon [][]Coord
+
+// MultiPoint is a collection of points.
+type MultiPoint []Coord
+
+// MultiLineString is a collection of line strings.
+type MultiLineString []LineString
+
+// MultiPolygon is a collection of polygons.
+type MultiPolygon []Polygon
+
+func (Point) Type() string           { return "Point" }
+func (LineString) Type() string      { return "LineString" }
+func (Polygon) Type() string         { return "Polygon" }
+func (MultiPoint) Type() string      { return "MultiPoint" }
+func (MultiLineString) Type() string { return "MultiLineString" }
+func (MultiPolygon) Type() string    { return "MultiPolygon" }
+
+// WKB geometry type codes
+const (
+	wkbPoint           = 1
+	wkbLineString      = 2
+	wkbPolygon         = 3
+	wkbMultiPoint      = 4
+	wkbMultiLineString = 5
+	wkbMultiPolygon    = 6
+
+	wkbGeometryCollection = 7
+
+	// ewkbSRID flags EWKB geometries with an embedded SRID.
+	ewkbSRID = 0x20000000
+)
+
+func appendWKBHeader(b []byte, typ uint32) []byte {
+	b = append(b, 1) // little endian
+	return appendUint32(b, typ)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendCoord(b []byte, c Coord) []byte {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], math.Float64bits(c.X))
+	binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(c.Y))
+	return append(b, buf[:]...)
+}
+
+func appendCoords(b []byte, cs []Coord) []byte {
+	b = appendUint32(b, uint32(len(cs)))
+	for _, c := range cs {
+		b = appendCoord(b, c)
+	}
+	return b
+}
+
+func (p Point) appendWKB(b []byte) []byte {
+	b = appendWKBHeader(b, wkbPoint)
+	return appendCoord(b, Coord(p))
+}
+
+func (l LineString) appendWKB(b []byte) []byte {
+	b = appendWKBHeader(b, wkbLineString)
+	return appendCoords(b, l)
+}
+
+func (p Polygon) appendWKB(b []byte) []byte {
+	b = appendWKBHeader(b, wkbPolygon)
+	b = appendUint32(b, uint32(len(p)))
+	for _, r := range p {
+		b = appendCoords(b, r)
+	}
+	return b
+}
+
+func (mp MultiPoint) appendWKB(b []byte) []byte {
+	b = appendWKBHeader(b, wkbMultiPoint)
+	b = appendUint32(b, uint32(len(mp)))
+	for _, p := range mp {
+		b = Point(p).appendWKB(b)
+	}
+	return b
+}
+
+func (ml MultiLineString) appendWKB(b []byte) []byte {
+	b = appendWKBHeader(b, wkbMultiLineString)
+	b = appendUint32(b, uint32(len(ml)))
+	for _, l := range ml {
+		b = l.appendWKB(b)
+	}
+	return b
+}
+
+func (mp MultiPolygon) appendWKB(b []byte) []byte {
+	b = appendWKBHeader(b, wkbMultiPolygon)
+	b = appendUint32(b, uint32(len(mp)))
+	for _, p := range mp {
+		b = p.appendWKB(b)
+	}
+	return b
+}
+
+// GeometryCollection is a collection of geometries of any type.
+type GeometryCollection []Geometry
+
+func (GeometryCollection) Type() string { return "GeometryCollection" }
+
+func (gc GeometryCollection) appendWKB(b []byte) []byte {
+	b = appendWKBHeader(b, wkbGeometryCollection)
+	b = appendUint32(b, uint32(len(gc)))
+	for _, g := range gc {
+		b = g.appendWKB(b)
+	}
+	return b
+}
+
+// MarshalWKB encodes the geometry as little endian well-known binary.
+func MarshalWKB(g Geometry) []byte {
+	return g.appendWKB(nil)
+}
+
+// UnmarshalWKB decodes a geometry from well-known binary in little or big endian.
+// The SRID of EWKB is ignored, geometries with Z or M values are not supported.
+func UnmarshalWKB(b []byte) (Geometry, error) {
+	r := &wkbReader{b: b}
+	g := r.geometry()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(b) {
+		return nil, errors.New("mapnik: trailing data after WKB geometry")
+	}
+	return g, nil
+}
+
+type wkbReader struct {
+	b     []byte
+	pos   int
+	order binary.ByteOrder
+	err   error
+}
+
+func (r *wkbReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.pos+n > len(r.b) {
+		r.err = errors.New("mapnik: truncated WKB geometry")
+		return nil
+	}
+	buf := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return buf
+}
+
+func (r *wkbReader) uint32() uint32 {
+	buf := r.read(4)
+	if buf == nil {
+		return 0
+	}
+	return r.order.Uint32(buf)
+}
+
+func (r *wkbReader) count() int {
+	n := int(r.uint32())
+	// every element needs at least 8 bytes, protects against huge allocations
+	if r.err == nil && n > (len(r.b)-r.pos)/8+1 {
+		r.err = errors.New("mapnik: invalid element count in WKB geometry")
+		return 0
+	}
+	return n
+}
+
+func (r *wkbReader) coord() Coord {
+	buf := r.read(16)
+	if buf == nil {
+		return Coord{}
+	}
+	return Coord{
+		math.Float64frombits(r.order.Uint64(buf[:8])),
+		math.Float64frombits(r.order.Uint64(buf[8:])),
+	}
+}
+
+func (r *wkbReader) coords() []Coord {
+	n := r.count()
+	cs := make([]Coord, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		cs = append(cs, r.coord())
+	}
+	return cs
+}
+
+func (r *wkbReader) header() uint32 {
+	buf := r.read(1)
+	if buf == nil {
+		return 0
+	}
+	switch buf[0] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		r.err = errors.New("mapnik: invalid byte order in WKB geometry")
+		return 0
+	}
+	typ := r.uint32()
+	if typ&ewkbSRID != 0 {
+		r.uint32()
+		typ &^= ewkbSRID
+	}
+	return typ
+}
+
+func (r *wkbReader) geometry() Geometry {
+	typ := r.header()
+	if r.err != nil {
+		return nil
+	}
+	switch typ {
+	case wkbPoint:
+		return Point(r.coord())
+	case wkbLineString:
+		return LineString(r.coords())
+	case wkbPolygon:
+		return r.polygon()
+	case wkbMultiPoint:
+		n := r.count()
+		mp := make(MultiPoint, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			if p, ok := r.geometry().(Point); ok {
+				mp = append(mp, Coord(p))
+			} else if r.err == nil {
+				r.err = errors.New("mapnik: invalid member of WKB MultiPoint")
+			}
+		}
+		return mp
+	case wkbMultiLineString:
+		n := r.count()
+		ml := make(MultiLineString, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			if l, ok := r.geometry().(LineString); ok {
+				ml = append(ml, l)
+			} else if r.err == nil {
+				r.err = errors.New("mapnik: invalid member of WKB MultiLineString")
+			}
+		}
+		return ml
+	case wkbMultiPolygon:
+		n := r.count()
+		mp := make(MultiPolygon, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			if p, ok := r.geometry().(Polygon); ok {
+				mp = append(mp, p)
+			} else if r.err == nil {
+				r.err = errors.New("mapnik: invalid member of WKB MultiPolygon")
+			}
+		}
+		return mp
+	case wkbGeometryCollection:
+		n := r.count()
+		gc := make(GeometryCollection, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			gc = append(gc, r.geometry())
+		}
+		return gc
+	}
+	r.err = fmt.Errorf("mapnik: unsupported WKB geometry type %d", typ)
+	return nil
+}
+
+func (r *wkbReader) polygon() Polygon {
+	n := r.count()
+	p := make(Polygon, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		p = append(p, r.coords())
+	}
+	return p
+}
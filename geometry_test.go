@@ -0,0 +1,140 @@
+package mapnik
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestAppendWKB(t *testing.T) {
+	for _, tc := range []struct {
+		geom     Geometry
+		expected string
+	}{
+		{Point{1, 2}, "0101000000000000000000f03f0000000000000040"},
+		{LineString{{1, 2}, {3, 4}},
+			"010200000002000000000000000000f03f000000000000004000000000000008400000000000001040"},
+		{MultiPoint{{1, 2}},
+			"0104000000010000000101000000000000000000f03f0000000000000040"},
+	} {
+		if wkb := hex.EncodeToString(tc.geom.appendWKB(nil)); wkb != tc.expected {
+			t.Errorf("unexpected WKB for %s: %s", tc.geom.Type(), wkb)
+		}
+	}
+}
+
+var testGeometries = []Geometry{
+	Point{1, 2},
+	LineString{{1, 2}, {3, 4.5}},
+	Polygon{{{0, 0}, {10, 0}, {10, 10}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}},
+	MultiPoint{{1, 2}, {-3, 4}},
+	MultiLineString{{{1, 2}, {3, 4}}, {{5, 6}, {7, 8}}},
+	MultiPolygon{{{{0, 0}, {10, 0}, {10, 10}, {0, 0}}}, {{{20, 20}, {30, 20}, {30, 30}, {20, 20}}}},
+	GeometryCollection{Point{1, 2}, LineString{{1, 2}, {3, 4}}},
+}
+
+func TestWKBRoundTrip(t *testing.T) {
+	for _, g := range testGeometries {
+		actual, err := UnmarshalWKB(MarshalWKB(g))
+		if err != nil {
+			t.Fatal(g.Type(), err)
+		}
+		assertEqual(t, g, actual)
+	}
+}
+
+func TestUnmarshalWKB(t *testing.T) {
+	// big endian point
+	b, _ := hex.DecodeString("00000000013ff00000000000004000000000000000")
+	g, err := UnmarshalWKB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, Point{1, 2}, g)
+
+	// EWKB point with SRID 4326
+	b, _ = hex.DecodeString("0101000020e6100000000000000000f03f0000000000000040")
+	g, err = UnmarshalWKB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, Point{1, 2}, g)
+
+	for _, invalid := range []string{"", "01", "0101000000000000000000f03f", "0209000000", "01020000000000ffff"} {
+		b, _ := hex.DecodeString(invalid)
+		if _, err := UnmarshalWKB(b); err == nil {
+			t.Errorf("invalid WKB %q did not return an error", invalid)
+		}
+	}
+}
+
+func TestWKT(t *testing.T) {
+	expected := []string{
+		"POINT (1 2)",
+		"LINESTRING (1 2, 3 4.5)",
+		"POLYGON ((0 0, 10 0, 10 10, 0 0), (1 1, 2 1, 2 2, 1 1))",
+		"MULTIPOINT ((1 2), (-3 4))",
+		"MULTILINESTRING ((1 2, 3 4), (5 6, 7 8))",
+		"MULTIPOLYGON (((0 0, 10 0, 10 10, 0 0)), ((20 20, 30 20, 30 30, 20 20)))",
+		"GEOMETRYCOLLECTION (POINT (1 2), LINESTRING (1 2, 3 4))",
+	}
+	for i, g := range testGeometries {
+		wkt := MarshalWKT(g)
+		assertEqual(t, expected[i], wkt)
+		actual, err := UnmarshalWKT(wkt)
+		if err != nil {
+			t.Fatal(wkt, err)
+		}
+		assertEqual(t, g, actual)
+	}
+
+	g, err := UnmarshalWKT("multipoint(1 2,-3 4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, MultiPoint{{1, 2}, {-3, 4}}, g)
+
+	g, err = UnmarshalWKT("LINESTRING EMPTY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, LineString{}, g)
+
+	for _, invalid := range []string{"", "POINT", "POINT (1)", "POINT (1 2", "LINESTRING (1 2, 3 4) foo", "CIRCLE (1 2)"} {
+		if _, err := UnmarshalWKT(invalid); err == nil {
+			t.Errorf("invalid WKT %q did not return an error", invalid)
+		}
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	for _, g := range testGeometries {
+		b, err := MarshalGeoJSON(g)
+		if err != nil {
+			t.Fatal(g.Type(), err)
+		}
+		actual, err := UnmarshalGeoJSON(b)
+		if err != nil {
+			t.Fatal(string(b), err)
+		}
+		assertEqual(t, g, actual)
+	}
+
+	b, err := MarshalGeoJSON(LineString{{1, 2}, {3, 4.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, `{"type":"LineString","coordinates":[[1,2],[3,4.5]]}`, string(b))
+
+	g, err := UnmarshalGeoJSON([]byte(`{"type": "Point", "coordinates": [1, 2, 100]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, Point{1, 2}, g)
+
+	for _, invalid := range []string{`{}`, `{"type": "Point"}`, `{"type": "Point", "coordinates": [1]}`,
+		`{"type": "LineString", "coordinates": [1, 2]}`, `{"type": "Circle", "coordinates": [1, 2]}`} {
+		if _, err := UnmarshalGeoJSON([]byte(invalid)); err == nil {
+			t.Errorf("invalid GeoJSON %s did not return an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+// Package gpx renders GPX tracks, routes and waypoints on top of a Mapnik map.
+package gpx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/internal/style"
+)
+
+// DefaultZoom is used when the map is zoomed to a GPX with a single point.
+const DefaultZoom = 15
+
+// Point is a track, route or waypoint position.
+type Point struct {
+	Lat  float64   `xml:"lat,attr"`
+	Lon  float64   `xml:"lon,attr"`
+	Ele  *float64  `xml:"ele"`
+	Time time.Time `xml:"time"`
+	Name string    `xml:"name"`
+}
+
+// Segment is a continuous part of a track.
+type Segment struct {
+	Points []Point `xml:"trkpt"`
+}
+
+// Track is an ordered list of segments.
+type Track struct {
+	Name     string    `xml:"name"`
+	Segments []Segment `xml:"trkseg"`
+}
+
+// Route is an ordered list of points leading to a destination.
+type Route struct {
+	Name   string  `xml:"name"`
+	Points []Point `xml:"rtept"`
+}
+
+// GPX is the content of a GPX file.
+type GPX struct {
+	Waypoints []Point `xml:"wpt"`
+	Routes    []Route `xml:"rte"`
+	Tracks    []Track `xml:"trk"`
+}
+
+// Parse reads a GPX document from r.
+func Parse(r io.Reader) (*GPX, error) {
+	g := &GPX{}
+	if err := xml.NewDecoder(r).Decode(g); err != nil {
+		return nil, fmt.Errorf("gpx: %v", err)
+	}
+	return g, nil
+}
+
+// ParseFile reads a GPX file.
+func ParseFile(path string) (*GPX, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// BBox returns the bounding box of all points. ok is false if the GPX contains no points.
+func (g *GPX) BBox() (minLon, minLat, maxLon, maxLat float64, ok bool) {
+	minLon, minLat = math.Inf(1), math.Inf(1)
+	maxLon, maxLat = math.Inf(-1), math.Inf(-1)
+	g.eachPoint(func(p Point) {
+		minLon, minLat = math.Min(minLon, p.Lon), math.Min(minLat, p.Lat)
+		maxLon, maxLat = math.Max(maxLon, p.Lon), math.Max(maxLat, p.Lat)
+		ok = true
+	})
+	return
+}
+
+func (g *GPX) eachPoint(fn func(Point)) {
+	for _, p := range g.Waypoints {
+		fn(p)
+	}
+	for _, r := range g.Routes {
+		for _, p := range r.Points {
+			fn(p)
+		}
+	}
+	for _, t := range g.Tracks {
+		for _, s := range t.Segments {
+			for _, p := range s.Points {
+				fn(p)
+			}
+		}
+	}
+}
+
+// ColorBy defines how track segments are colored.
+type ColorBy int
+
+const (
+	// Solid colors the whole track with Options.Color.
+	Solid ColorBy = iota
+	// Elevation colors each track segment by its average elevation.
+	Elevation
+	// Speed colors each track segment by its speed. Requires timestamps for all track points.
+	Speed
+)
+
+// DefaultRamp is the color ramp for Elevation and Speed, from low to high values.
+var DefaultRamp = []color.NRGBA{
+	{26, 152, 80, 255},
+	{145, 207, 96, 255},
+	{217, 239, 139, 255},
+	{254, 224, 139, 255},
+	{252, 141, 89, 255},
+	{215, 48, 39, 255},
+}
+
+// Options defines the style of the GPX layer.
+type Options struct {
+	// Name of the layer and the style. Defaults to "gpx".
+	Name string
+	// ColorBy defines the coloring of tracks.
+	ColorBy ColorBy
+	// Color of tracks and routes. Defaults to blue.
+	Color color.NRGBA
+	// Ramp for Elevation and Speed coloring. Defaults to DefaultRamp.
+	Ramp []color.NRGBA
+	// Width of tracks and routes in pixel. Defaults to 3.
+	Width float64
+	// FontFace of the waypoint labels. Defaults to "DejaVu Sans Book".
+	FontFace string
+	// Zoom the map to all points of the GPX, with Padding in pixel.
+	Zoom    bool
+	Padding int
+}
+
+// Features returns the tracks, routes and waypoints as features. Tracks are split into one
+// feature for each pair of points if they are colored by elevation or speed. All features
+// have a gpx_type (track, route or waypoint) and a name attribute, track features have a bucket
+// attribute with the index of their color in the ramp.
+func (g *GPX) Features(opts Options) ([]mapnik.Feature, error) {
+	var features []mapnik.Feature
+	add := func(geom mapnik.Geometry, typ, name string, bucket int) {
+		features = append(features, mapnik.Feature{
+			Geometry:   geom,
+			Properties: map[string]interface{}{"gpx_type": typ, "name": name, "bucket": bucket},
+		})
+	}
+
+	for _, t := range g.Tracks {
+		if opts.ColorBy == Solid {
+			ml := mapnik.MultiLineString{}
+			for _, s := range t.Segments {
+				if len(s.Points) > 1 {
+					ml = append(ml, lineString(s.Points))
+				}
+			}
+			if len(ml) > 0 {
+				add(ml, "track", t.Name, 0)
+			}
+			continue
+		}
+
+		var lines []mapnik.LineString
+		var values []float64
+		for _, s := range t.Segments {
+			for i := 1; i < len(s.Points); i++ {
+				v, err := segmentValue(opts.ColorBy, s.Points[i-1], s.Points[i])
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, lineString(s.Points[i-1:i+1]))
+				values = append(values, v)
+			}
+		}
+		buckets := classify(values, len(ramp(opts)))
+		for i, l := range lines {
+			add(l, "track", t.Name, buckets[i])
+		}
+	}
+
+	for _, r := range g.Routes {
+		if len(r.Points) > 1 {
+			add(lineString(r.Points), "route", r.Name, 0)
+		}
+	}
+	for _, p := range g.Waypoints {
+		add(mapnik.Point{X: p.Lon, Y: p.Lat}, "waypoint", p.Name, 0)
+	}
+	return features, nil
+}
+
+func lineString(points []Point) mapnik.LineString {
+	l := make(mapnik.LineString, len(points))
+	for i, p := range points {
+		l[i] = mapnik.Coord{X: p.Lon, Y: p.Lat}
+	}
+	return l
+}
+
+// segmentValue returns the average elevation in meters or the speed in km/h between two points.
+func segmentValue(by ColorBy, a, b Point) (float64, error) {
+	if by == Elevation {
+		if a.Ele == nil || b.Ele == nil {
+			return 0, errors.New("gpx: coloring by elevation requires elevation for all track points")
+		}
+		return (*a.Ele + *b.Ele) / 2, nil
+	}
+	if a.Time.IsZero() || b.Time.IsZero() {
+		return 0, errors.New("gpx: coloring by speed requires timestamps for all track points")
+	}
+	dt := b.Time.Sub(a.Time).Hours()
+	if dt <= 0 {
+		return 0, nil
+	}
+	return distance(a, b) / 1000 / dt, nil
+}
+
+// distance returns the great-circle distance between two points in meters.
+func distance(a, b Point) float64 {
+	const earthRadius = 6371008.8
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dlat := lat2 - lat1
+	dlon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// classify returns the index of one of n equal intervals between the min and max value for each value.
+func classify(values []float64, n int) []int {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+	buckets := make([]int, len(values))
+	if max <= min {
+		return buckets
+	}
+	for i, v := range values {
+		b := int((v - min) / (max - min) * float64(n))
+		if b >= n {
+			b = n - 1
+		}
+		buckets[i] = b
+	}
+	return buckets
+}
+
+func ramp(opts Options) []color.NRGBA {
+	if len(opts.Ramp) > 0 {
+		return opts.Ramp
+	}
+	return DefaultRamp
+}
+
+// Style returns the Mapnik XML of the default styles for the features of the GPX: the style
+// Options.Name and the style Options.Name-casing with the casing of tracks, which has to be
+// drawn first.
+func Style(opts Options) string {
+	name := opts.Name
+	if name == "" {
+		name = "gpx"
+	}
+	width := opts.Width
+	if width == 0 {
+		width = 3
+	}
+	c := opts.Color
+	if c == (color.NRGBA{}) {
+		c = color.NRGBA{0, 0, 255, 255}
+	}
+	face := opts.FontFace
+	if face == "" {
+		face = "DejaVu Sans Book"
+	}
+
+	buf := &bytes.Buffer{}
+	// separate style for the white casing below the track, so that the casing of a segment
+	// does not paint over the joint with the previous segment
+	fmt.Fprintf(buf, "<Map>\n<Style name=\"%s-casing\">\n", style.Escape(name))
+	buf.WriteString("<Rule><Filter>[gpx_type] = 'track'</Filter>\n")
+	fmt.Fprintf(buf, "<LineSymbolizer stroke=\"white\" stroke-width=\"%g\" stroke-linejoin=\"round\" stroke-linecap=\"round\" />\n", width+2)
+	buf.WriteString("</Rule>\n</Style>\n")
+
+	fmt.Fprintf(buf, "<Style name=\"%s\">\n", style.Escape(name))
+	fmt.Fprintf(buf, "<Rule><Filter>[gpx_type] = 'route'</Filter>\n")
+	fmt.Fprintf(buf, "<LineSymbolizer stroke=\"%s\" stroke-width=\"%g\" stroke-dasharray=\"%g,%g\" stroke-linejoin=\"round\" />\n",
+		style.RGBA(c), width, 3*width, 2*width)
+	buf.WriteString("</Rule>\n")
+
+	colors := []color.NRGBA{c}
+	if opts.ColorBy != Solid {
+		colors = ramp(opts)
+	}
+	for i, c := range colors {
+		fmt.Fprintf(buf, "<Rule><Filter>[gpx_type] = 'track' and [bucket] = %d</Filter>\n", i)
+		fmt.Fprintf(buf, "<LineSymbolizer stroke=\"%s\" stroke-width=\"%g\" stroke-linejoin=\"round\" stroke-linecap=\"round\" />\n",
+			style.RGBA(c), width)
+		buf.WriteString("</Rule>\n")
+	}
+
+	buf.WriteString("<Rule><Filter>[gpx_type] = 'waypoint'</Filter>\n")
+	buf.WriteString("<MarkersSymbolizer fill=\"white\" stroke=\"black\" stroke-width=\"2\" width=\"10\" height=\"10\" allow-overlap=\"true\" />\n")
+	fmt.Fprintf(buf, "<TextSymbolizer face-name=\"%s\" size=\"11\" fill=\"black\" halo-fill=\"white\" halo-radius=\"1.5\" placement-type=\"simple\" placements=\"N,S,E,W\" dy=\"8\" dx=\"8\">[name]</TextSymbolizer>\n",
+		style.Escape(face))
+	buf.WriteString("</Rule>\n")
+	buf.WriteString("</Style>\n</Map>\n")
+	return buf.String()
+}
+
+// AddToMap adds the GPX as a new layer with the default styles to m. The layer and the styles
+// are named after Options.Name, see Style, and can be removed with Map.RemoveLayer and
+// Map.RemoveStyle.
+func (g *GPX) AddToMap(m *mapnik.Map, opts Options) error {
+	name := opts.Name
+	if name == "" {
+		name = "gpx"
+	}
+	features, err := g.Features(opts)
+	if err != nil {
+		return err
+	}
+	if len(features) == 0 {
+		return errors.New("gpx: no tracks, routes or waypoints")
+	}
+	ds, err := mapnik.NewMemoryDatasource(features)
+	if err != nil {
+		return err
+	}
+	defer ds.Free()
+
+	if err := m.LoadString(Style(opts), ""); err != nil {
+		return err
+	}
+	l := mapnik.NewLayer(name, mapnik.WGS84)
+	defer l.Free()
+	l.AddStyle(name + "-casing")
+	l.AddStyle(name)
+	l.SetDatasource(ds)
+	m.AddLayer(l)
+
+	if opts.Zoom {
+		minLon, minLat, maxLon, maxLat, _ := g.BBox()
+		if minLon == maxLon && minLat == maxLat {
+			return m.ZoomToZoomLevel(minLon, minLat, DefaultZoom)
+		}
+		return m.ZoomToLonLat(minLon, minLat, maxLon, maxLat, opts.Padding)
+	}
+	return nil
+}
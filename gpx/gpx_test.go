@@ -0,0 +1,143 @@
+package gpx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+func TestParseFile(t *testing.T) {
+	g, err := ParseFile("../test/test_track.gpx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Tracks) != 1 || len(g.Tracks[0].Segments) != 1 || len(g.Tracks[0].Segments[0].Points) != 4 {
+		t.Fatal("unexpected tracks", g.Tracks)
+	}
+	if g.Tracks[0].Name != "Test" {
+		t.Error("unexpected track name", g.Tracks[0].Name)
+	}
+	p := g.Tracks[0].Segments[0].Points[0]
+	if p.Lat != 53.558914 || p.Lon != 9.945955 || p.Ele == nil || *p.Ele != 24 {
+		t.Error("unexpected track point", p)
+	}
+
+	minLon, minLat, maxLon, maxLat, ok := g.BBox()
+	if !ok || minLon != 9.945392 || minLat != 53.55862 || maxLon != 9.945955 || maxLat != 53.558914 {
+		t.Error("unexpected bbox", minLon, minLat, maxLon, maxLat)
+	}
+}
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1">
+  <wpt lat="53.5" lon="10.0"><name>Start</name></wpt>
+  <trk><trkseg>
+    <trkpt lat="53.5" lon="10.0"><ele>10</ele><time>2020-01-01T10:00:00Z</time></trkpt>
+    <trkpt lat="53.5" lon="10.01"><ele>20</ele><time>2020-01-01T10:01:00Z</time></trkpt>
+    <trkpt lat="53.5" lon="10.02"><ele>50</ele><time>2020-01-01T10:01:30Z</time></trkpt>
+  </trkseg></trk>
+  <rte><name>Route</name><rtept lat="53.6" lon="10.0" /><rtept lat="53.6" lon="10.1" /></rte>
+</gpx>`
+
+func TestFeatures(t *testing.T) {
+	g, err := Parse(strings.NewReader(testGPX))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	features, err := g.Features(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 3 {
+		t.Fatal("unexpected features", features)
+	}
+	if _, ok := features[0].Geometry.(mapnik.MultiLineString); !ok {
+		t.Error("unexpected track geometry", features[0].Geometry)
+	}
+
+	features, err = g.Features(Options{ColorBy: Elevation})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 4 {
+		t.Fatal("unexpected features", features)
+	}
+	if b0, b1 := features[0].Properties["bucket"], features[1].Properties["bucket"]; b0 != 0 || b1 != len(DefaultRamp)-1 {
+		t.Error("unexpected elevation buckets", b0, b1)
+	}
+
+	// the second segment is twice as fast
+	features, err = g.Features(Options{ColorBy: Speed, Ramp: DefaultRamp[:2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b0, b1 := features[0].Properties["bucket"], features[1].Properties["bucket"]; b0 != 0 || b1 != 1 {
+		t.Error("unexpected speed buckets", b0, b1)
+	}
+
+	g, err = ParseFile("../test/test_track.gpx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Features(Options{ColorBy: Speed}); err == nil {
+		t.Error("speed without timestamps did not return an error")
+	}
+}
+
+func TestAddToMap(t *testing.T) {
+	g, err := ParseFile("../test/test_track.gpx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mapnik.New()
+	if err := m.Load("../test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	layers := m.CountLayers()
+	if err := g.AddToMap(m, Options{ColorBy: Elevation, Zoom: true, Padding: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if m.CountLayers() != layers+1 {
+		t.Error("GPX layer not added")
+	}
+	minx, miny, maxx, maxy := m.CurrentExtent()
+	if minx > 9.945392 || miny > 53.55862 || maxx < 9.945955 || maxy < 53.558914 {
+		t.Error("track outside of map extent", minx, miny, maxx, maxy)
+	}
+	if _, err := m.Render(mapnik.RenderOpts{}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.RemoveLayer("gpx")
+	m.RemoveStyle("gpx")
+	m.RemoveStyle("gpx-casing")
+	if m.CountLayers() != layers {
+		t.Error("GPX layer not removed")
+	}
+}
+
+func TestTrackJoints(t *testing.T) {
+	g, err := Parse(strings.NewReader(testGPX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mapnik.New()
+	defer m.Free()
+	m.SetSRS(mapnik.WGS84)
+	m.Resize(400, 200)
+	if err := g.AddToMap(m, Options{ColorBy: Elevation}); err != nil {
+		t.Fatal(err)
+	}
+	m.ZoomTo(9.99, 53.49, 10.03, 53.51)
+	img, err := m.RenderImage(mapnik.RenderOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the joint of the two segments at 10.01, 53.5 is not covered by the casing
+	c := img.NRGBAAt(200, 100)
+	if c != DefaultRamp[0] && c != DefaultRamp[len(DefaultRamp)-1] {
+		t.Error("unexpected color at the joint", c)
+	}
+}
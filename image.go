@@ -0,0 +1,38 @@
+package mapnik
+
+import (
+	"image"
+	"image/color"
+)
+
+// SolidColor returns the color of img and true if all pixels have the same color, e.g. for
+// ocean or empty tiles. Fully transparent pixels are equal regardless of their RGB values and
+// are returned as color.NRGBA{}.
+func SolidColor(img *image.NRGBA) (color.NRGBA, bool) {
+	b := img.Bounds()
+	if b.Empty() {
+		return color.NRGBA{}, false
+	}
+	first := img.NRGBAAt(b.Min.X, b.Min.Y)
+	if first.A == 0 {
+		first = color.NRGBA{}
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			if row[i+3] == 0 && first.A == 0 {
+				continue
+			}
+			if row[i] != first.R || row[i+1] != first.G || row[i+2] != first.B || row[i+3] != first.A {
+				return color.NRGBA{}, false
+			}
+		}
+	}
+	return first, true
+}
+
+// IsBlank returns whether all pixels of img are fully transparent.
+func IsBlank(img *image.NRGBA) bool {
+	c, ok := SolidColor(img)
+	return ok && c.A == 0
+}
@@ -0,0 +1,38 @@
+package mapnik
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestSolidColor(t *testing.T) {
+	blue := color.NRGBA{0, 0, 255, 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	if c, ok := SolidColor(img); !ok || c != (color.NRGBA{}) || !IsBlank(img) {
+		t.Error("new image not blank", c, ok)
+	}
+	// transparent pixels with different RGB values are still blank
+	img.SetNRGBA(3, 3, color.NRGBA{255, 0, 0, 0})
+	if !IsBlank(img) {
+		t.Error("transparent image not blank")
+	}
+
+	draw.Draw(img, img.Bounds(), image.NewUniform(blue), image.Point{}, draw.Src)
+	if c, ok := SolidColor(img); !ok || c != blue || IsBlank(img) {
+		t.Error("expected solid blue, got", c, ok)
+	}
+
+	img.SetNRGBA(15, 15, color.NRGBA{0, 0, 254, 255})
+	if _, ok := SolidColor(img); ok {
+		t.Error("image with two colors is solid")
+	}
+	// sub images only check their own pixels
+	if c, ok := SolidColor(img.SubImage(image.Rect(0, 0, 8, 8)).(*image.NRGBA)); !ok || c != blue {
+		t.Error("expected solid blue sub image, got", c, ok)
+	}
+	if _, ok := SolidColor(image.NewNRGBA(image.Rectangle{})); ok {
+		t.Error("empty image is solid")
+	}
+}
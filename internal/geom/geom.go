@@ -0,0 +1,59 @@
+// Package geom has the geometry tests shared by the tile packages.
+package geom
+
+import (
+	"math"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+// Contains returns whether c is within the exterior ring, the first ring, and outside of all
+// holes of the polygon.
+func Contains(rings [][]mapnik.Coord, c mapnik.Coord) bool {
+	if len(rings) == 0 {
+		return false
+	}
+	for i, r := range rings {
+		if RingContains(r, c) != (i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// RingContains is the even-odd rule point in polygon test.
+func RingContains(r []mapnik.Coord, c mapnik.Coord) bool {
+	in := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a.Y > c.Y) != (b.Y > c.Y) && c.X < (b.X-a.X)*(c.Y-a.Y)/(b.Y-a.Y)+a.X {
+			in = !in
+		}
+	}
+	return in
+}
+
+// SegmentIntersectsBox clips the segment at the box with the Liang-Barsky algorithm.
+func SegmentIntersectsBox(a, b mapnik.Coord, minx, miny, maxx, maxy float64) bool {
+	t0, t1 := 0.0, 1.0
+	dx, dy := b.X-a.X, b.Y-a.Y
+	for _, e := range [4][2]float64{{-dx, a.X - minx}, {dx, maxx - a.X}, {-dy, a.Y - miny}, {dy, maxy - a.Y}} {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			t0 = math.Max(t0, r)
+		} else {
+			t1 = math.Min(t1, r)
+		}
+		if t0 > t1 {
+			return false
+		}
+	}
+	return true
+}
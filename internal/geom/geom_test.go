@@ -0,0 +1,45 @@
+package geom
+
+import (
+	"testing"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+func TestContains(t *testing.T) {
+	square := func(min, max float64) []mapnik.Coord {
+		return []mapnik.Coord{{X: min, Y: min}, {X: max, Y: min}, {X: max, Y: max}, {X: min, Y: max}, {X: min, Y: min}}
+	}
+	donut := [][]mapnik.Coord{square(0, 10), square(4, 6)}
+	for _, tt := range []struct {
+		c        mapnik.Coord
+		expected bool
+	}{
+		{mapnik.Coord{X: 2, Y: 2}, true},
+		{mapnik.Coord{X: 5, Y: 5}, false},
+		{mapnik.Coord{X: 12, Y: 5}, false},
+	} {
+		if Contains(donut, tt.c) != tt.expected {
+			t.Error("unexpected result for", tt.c)
+		}
+	}
+	if Contains(nil, mapnik.Coord{}) {
+		t.Error("empty polygon contains a point")
+	}
+}
+
+func TestSegmentIntersectsBox(t *testing.T) {
+	for _, tt := range []struct {
+		a, b     mapnik.Coord
+		expected bool
+	}{
+		{mapnik.Coord{X: -1, Y: 0.5}, mapnik.Coord{X: 2, Y: 0.5}, true},
+		{mapnik.Coord{X: 0.2, Y: 0.2}, mapnik.Coord{X: 0.8, Y: 0.8}, true},
+		{mapnik.Coord{X: -1, Y: 2}, mapnik.Coord{X: 2, Y: 2}, false},
+		{mapnik.Coord{X: 1.5, Y: 0}, mapnik.Coord{X: 3, Y: 2}, false},
+	} {
+		if SegmentIntersectsBox(tt.a, tt.b, 0, 0, 1, 1) != tt.expected {
+			t.Error("unexpected result for", tt.a, tt.b)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Package style has the helpers shared by the packages that generate stylesheets.
+package style
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+)
+
+// Escape escapes s for XML attributes and text.
+func Escape(s string) string {
+	buf := &bytes.Buffer{}
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
+
+// RGBA formats c as a Mapnik color.
+func RGBA(c color.NRGBA) string {
+	return fmt.Sprintf("rgba(%d,%d,%d,%.3f)", c.R, c.G, c.B, float64(c.A)/255)
+}
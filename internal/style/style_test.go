@@ -0,0 +1,18 @@
+package style
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	if s := Escape(`a<b & "c"`); s != "a&lt;b &amp; &#34;c&#34;" {
+		t.Error("unexpected escape", s)
+	}
+}
+
+func TestRGBA(t *testing.T) {
+	if s := RGBA(color.NRGBA{255, 0, 128, 51}); s != "rgba(255,0,128,0.200)" {
+		t.Error("unexpected color", s)
+	}
+}
@@ -0,0 +1,286 @@
+package mapnik
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LoadOptions configures LoadWith and LoadStringWith.
+type LoadOptions struct {
+	// Strict loads the stylesheet with Mapnik's strict mode, which rejects unknown elements
+	// and attributes and datasource errors, and checks for layers with missing styles, unused
+	// styles and missing files. All problems are returned in a *LoadError, except that
+	// Mapnik reports unknown elements and attributes only if it found no other error. The
+	// map may be partially loaded after an error.
+	Strict bool
+}
+
+// Problem is an issue of a stylesheet found by a strict load.
+type Problem struct {
+	// Line is the line in the stylesheet, 0 if unknown.
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return "line " + strconv.Itoa(p.Line) + ": " + p.Message
+	}
+	return p.Message
+}
+
+// LoadError lists the problems of a stylesheet, sorted by line.
+type LoadError struct {
+	Problems []Problem
+}
+
+func (e *LoadError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return "mapnik: " + strings.Join(lines, "\n")
+}
+
+// LoadWith reads in a Mapnik map XML like Load.
+func (m *Map) LoadWith(stylesheet string, opts LoadOptions) error {
+	if !opts.Strict {
+		return m.Load(stylesheet)
+	}
+	b, err := ioutil.ReadFile(stylesheet)
+	if err != nil {
+		return errors.New("mapnik: " + err.Error())
+	}
+	return m.loadStrict(string(b), filepath.Dir(stylesheet))
+}
+
+// LoadStringWith reads in a Mapnik map from a XML string like LoadString.
+func (m *Map) LoadStringWith(s string, basePath string, opts LoadOptions) error {
+	if !opts.Strict {
+		return m.LoadString(s, basePath)
+	}
+	return m.loadStrict(s, basePath)
+}
+
+func (m *Map) loadStrict(s string, basePath string) error {
+	problems := lintStylesheet(s, basePath)
+	if err := m.loadString(s, basePath, true); err != nil {
+		problems = append(problems, mapnikProblems(err.Error(), problems)...)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return &LoadError{Problems: problems}
+}
+
+var lineRe = regexp.MustCompile(`at line (\d+)`)
+
+// mapnikProblems splits the error of a strict Mapnik load into problems. Strict mode stops at
+// the first error, except for unknown elements and attributes which are reported as a list
+// of "* node 'x' at line n" items. Errors for files already reported missing are skipped.
+func mapnikProblems(msg string, found []Problem) []Problem {
+	var items []string
+	for _, line := range strings.Split(msg, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "* ") {
+			items = append(items, line[2:])
+		}
+	}
+	if items == nil {
+		items = []string{strings.TrimPrefix(strings.TrimSpace(msg), "mapnik: ")}
+	}
+	var problems []Problem
+items:
+	for _, item := range items {
+		for _, p := range found {
+			if file := strings.TrimPrefix(p.Message, "missing file "); file != p.Message && strings.Contains(item, file) {
+				continue items
+			}
+		}
+		p := Problem{Message: item}
+		if match := lineRe.FindStringSubmatch(item); match != nil {
+			p.Line, _ = strconv.Atoi(match[1])
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// fileDatasources are the datasource types with a file parameter.
+var fileDatasources = map[string]bool{
+	"csv": true, "gdal": true, "geojson": true, "ogr": true, "raster": true,
+	"shape": true, "sqlite": true, "topojson": true,
+}
+
+// stylesheetRef is a named element of a stylesheet.
+type stylesheetRef struct {
+	name string
+	line int
+}
+
+// fileRef is a file referenced by a stylesheet.
+type fileRef struct {
+	// file is the path as written in the stylesheet
+	file string
+	// base is the directory of a relative file, relative to the directory of the stylesheet
+	base string
+	line int
+	// datasource is the datasource type of a file parameter
+	datasource string
+	// dir is true for the font-directory
+	dir bool
+}
+
+// stylesheetInfo lists the styles, the style references of layers and the files of a
+// stylesheet.
+type stylesheetInfo struct {
+	styles, styleNames []stylesheetRef
+	files              []fileRef
+}
+
+// parseStylesheet collects the styles and files of a stylesheet. Syntax errors end the
+// parsing, they are reported by Mapnik.
+func parseStylesheet(s string) stylesheetInfo {
+	var info stylesheetInfo
+	d := xml.NewDecoder(strings.NewReader(s))
+	d.Strict = false
+	line, offset := 1, 0
+	var (
+		mapBase    string
+		path       []string
+		text       strings.Builder
+		params     map[string]string
+		paramsLine int
+		paramName  string
+	)
+	for {
+		// the line of the next token
+		next := int(d.InputOffset())
+		line += strings.Count(s[offset:next], "\n")
+		offset = next
+		tok, err := d.RawToken()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+			attrs := map[string]string{}
+			for _, a := range t.Attr {
+				attrs[a.Name.Local] = a.Value
+			}
+			switch t.Name.Local {
+			case "Map":
+				mapBase = attrs["base"]
+				if dir, ok := attrs["font-directory"]; ok {
+					info.files = append(info.files, fileRef{file: dir, line: line, dir: true})
+				}
+			case "Style":
+				info.styles = append(info.styles, stylesheetRef{attrs["name"], line})
+			case "Datasource":
+				params, paramsLine = map[string]string{}, line
+			case "Parameter":
+				paramName = attrs["name"]
+			default:
+				if file, ok := attrs["file"]; ok && strings.HasSuffix(t.Name.Local, "Symbolizer") {
+					info.files = append(info.files, fileRef{file: file, line: line})
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "StyleName":
+				info.styleNames = append(info.styleNames, stylesheetRef{strings.TrimSpace(text.String()), line})
+			case "Parameter":
+				if params != nil {
+					params[paramName] = strings.TrimSpace(text.String())
+				}
+			case "Datasource":
+				if file, ok := params["file"]; ok && fileDatasources[params["type"]] && len(path) > 1 && path[len(path)-2] == "Layer" {
+					base, ok := params["base"]
+					if !ok {
+						base = mapBase
+					}
+					info.files = append(info.files, fileRef{file: file, base: base, line: paramsLine, datasource: params["type"]})
+				}
+				params = nil
+			}
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+	return info
+}
+
+// lintStylesheet checks the stylesheet for layers with missing styles, unused styles and
+// missing files that Mapnik does not report, or reports only one at a time.
+func lintStylesheet(s string, basePath string) []Problem {
+	var problems []Problem
+	info := parseStylesheet(s)
+	for _, f := range info.files {
+		base := basePath
+		if filepath.IsAbs(f.base) {
+			base = f.base
+		} else if f.base != "" {
+			base = filepath.Join(basePath, f.base)
+		}
+		p := missingFile(f.file, base)
+		if p != "" && f.datasource == "shape" && !strings.HasSuffix(f.file, ".shp") {
+			p = missingFile(f.file+".shp", base)
+		}
+		if p != "" {
+			problems = append(problems, Problem{f.line, "missing file " + p})
+		}
+	}
+
+	defined := map[string]bool{}
+	for _, st := range info.styles {
+		defined[st.name] = true
+	}
+	used := map[string]bool{}
+	for _, sn := range info.styleNames {
+		used[sn.name] = true
+		if !defined[sn.name] {
+			problems = append(problems, Problem{sn.line, fmt.Sprintf("layer references missing style %q", sn.name)})
+		}
+	}
+	for _, st := range info.styles {
+		if !used[st.name] {
+			problems = append(problems, Problem{st.line, fmt.Sprintf("style %q is not used by any layer", st.name)})
+		}
+	}
+	return problems
+}
+
+// isPathExpression returns true for files that are not plain paths, like expressions,
+// entities and URLs.
+func isPathExpression(file string) bool {
+	return strings.ContainsAny(file, "[&") || strings.Contains(file, "://") ||
+		strings.HasPrefix(file, "data:") || strings.HasPrefix(file, "/vsi")
+}
+
+// missingFile returns the path of file relative to base if it does not exist. Expressions,
+// entities and URLs are not checked.
+func missingFile(file string, base string) string {
+	if file == "" || isPathExpression(file) {
+		return ""
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(base, file)
+	}
+	if _, err := os.Stat(file); err != nil {
+		return file
+	}
+	return ""
+}
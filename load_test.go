@@ -0,0 +1,90 @@
+package mapnik
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const lintStylesheetXML = `<Map font-directory="fonts">
+	<Style name="used"><Rule><PointSymbolizer file="marker.svg"/></Rule></Style>
+	<Style name="unused"><Rule><PointSymbolizer file="[icon].svg"/></Rule></Style>
+	<Layer name="a">
+		<StyleName>used</StyleName>
+		<StyleName>missing</StyleName>
+		<Datasource>
+			<Parameter name="type">shape</Parameter>
+			<Parameter name="file">roads</Parameter>
+		</Datasource>
+	</Layer>
+	<Layer name="b">
+		<StyleName>used</StyleName>
+		<Datasource>
+			<Parameter name="type">geojson</Parameter>
+			<Parameter name="file">map.geojson</Parameter>
+		</Datasource>
+	</Layer>
+	<Layer name="c">
+		<StyleName>used</StyleName>
+		<Datasource>
+			<Parameter name="type">postgis</Parameter>
+			<Parameter name="table">roads</Parameter>
+		</Datasource>
+	</Layer>
+</Map>`
+
+func TestLintStylesheet(t *testing.T) {
+	dir, err := filepath.Abs("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Problem{
+		{1, "missing file " + filepath.Join(dir, "fonts")},
+		{2, "missing file " + filepath.Join(dir, "marker.svg")},
+		{7, "missing file " + filepath.Join(dir, "roads.shp")},
+		{6, `layer references missing style "missing"`},
+		{3, `style "unused" is not used by any layer`},
+	}
+	if problems := lintStylesheet(lintStylesheetXML, dir); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+}
+
+func TestMapnikProblems(t *testing.T) {
+	found := []Problem{{7, "missing file /data/roads.shp"}}
+	tests := []struct {
+		msg      string
+		expected []Problem
+	}{
+		{
+			"mapnik: Unable to process some data while parsing '<string>':\n* node 'Foo' at line 3\n* attribute 'bar' with value '1' at line 5",
+			[]Problem{{3, "node 'Foo' at line 3"}, {5, "attribute 'bar' with value '1' at line 5"}},
+		},
+		{"mapnik: Shape Plugin: shapefile '/data/roads.shp' does not exist", nil},
+		{"mapnik: failed to parse color: 'nope' in Style at line 2", []Problem{{2, "failed to parse color: 'nope' in Style at line 2"}}},
+		{"mapnik: unknown error", []Problem{{0, "unknown error"}}},
+	}
+	for _, tt := range tests {
+		if problems := mapnikProblems(tt.msg, found); !reflect.DeepEqual(problems, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.msg, tt.expected, problems)
+		}
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	m := New()
+	defer m.Free()
+	if err := m.LoadWith("test/map.xml", LoadOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	m2 := New()
+	defer m2.Free()
+	err := m2.LoadStringWith(`<Map unknown="1">
+		<Layer name="a"><StyleName>missing</StyleName></Layer>
+	</Map>`, "test", LoadOptions{Strict: true})
+	le, ok := err.(*LoadError)
+	if !ok || len(le.Problems) != 2 || le.Problems[0].Line != 1 || le.Problems[1].Line != 2 {
+		t.Errorf("unexpected error %#v", err)
+	}
+}
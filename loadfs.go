@@ -0,0 +1,184 @@
+//go:build go1.16
+// +build go1.16
+
+package mapnik
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// LoadFS reads in a Mapnik map XML from fsys, e.g. an embed.FS. Relative paths of the
+// stylesheet, like datasource files, markers, patterns and the font-directory, are resolved
+// in fsys.
+//
+// Mapnik reads these files itself, so the files referenced by the stylesheet are copied to a
+// temporary directory. Maps loaded from the same fsys share the directory, it is removed when
+// the last of them is freed.
+func (m *Map) LoadFS(fsys fs.FS, name string) error {
+	if !fs.ValidPath(name) {
+		return errors.New("mapnik: invalid path " + name)
+	}
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return errors.New("mapnik: " + err.Error())
+	}
+	s := string(b)
+	c, err := acquireFSCache(fsys)
+	if err != nil {
+		return errors.New("mapnik: " + err.Error())
+	}
+	dir := path.Dir(name)
+	if err := c.materialize(dir, parseStylesheet(s).files); err != nil {
+		c.release()
+		return errors.New("mapnik: " + err.Error())
+	}
+	m.onFree = append(m.onFree, c.release)
+	return m.LoadString(s, filepath.Join(c.dir, filepath.FromSlash(dir)))
+}
+
+// fsCache is a temporary directory with the files of an fs.FS used by stylesheets.
+type fsCache struct {
+	fsys fs.FS
+	dir  string
+	// shared is true if the cache is in fsCaches
+	shared bool
+	// refs is the number of maps using the cache, guarded by fsCaches
+	refs int
+
+	mu sync.Mutex
+	// copied are the paths in fsys that are copied to dir
+	copied map[string]bool
+}
+
+// fsCaches are the caches of comparable fs.FS values like embed.FS and os.DirFS.
+var fsCaches = struct {
+	sync.Mutex
+	m map[fs.FS]*fsCache
+}{m: map[fs.FS]*fsCache{}}
+
+func acquireFSCache(fsys fs.FS) (*fsCache, error) {
+	fsCaches.Lock()
+	defer fsCaches.Unlock()
+	// other types like fstest.MapFS panic as map keys
+	shared := reflect.TypeOf(fsys).Comparable()
+	if shared {
+		if c, ok := fsCaches.m[fsys]; ok {
+			c.refs++
+			return c, nil
+		}
+	}
+	dir, err := ioutil.TempDir("", "go-mapnik-fs-")
+	if err != nil {
+		return nil, err
+	}
+	c := &fsCache{fsys: fsys, dir: dir, shared: shared, refs: 1, copied: map[string]bool{}}
+	if shared {
+		fsCaches.m[fsys] = c
+	}
+	return c, nil
+}
+
+func (c *fsCache) release() {
+	fsCaches.Lock()
+	defer fsCaches.Unlock()
+	c.refs--
+	if c.refs > 0 {
+		return
+	}
+	if c.shared {
+		delete(fsCaches.m, c.fsys)
+	}
+	os.RemoveAll(c.dir)
+}
+
+// materialize copies the files of a stylesheet in the directory dir of fsys. Datasource files
+// are copied with the files next to them with the same base name, like the .dbf and .shx
+// files of shapefiles. Absolute paths, expressions and files outside of fsys are skipped.
+func (c *fsCache) materialize(dir string, files []fileRef) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		if isPathExpression(f.file) || path.IsAbs(f.file) || path.IsAbs(f.base) {
+			continue
+		}
+		name := path.Join(dir, f.base, f.file)
+		if !fs.ValidPath(name) {
+			continue
+		}
+		var err error
+		switch {
+		case f.dir:
+			err = c.copyDir(name, "")
+		case f.datasource != "":
+			base := path.Base(name)
+			err = c.copyDir(path.Dir(name), strings.TrimSuffix(base, path.Ext(base))+".")
+			if err == nil {
+				err = c.copy(name)
+			}
+		default:
+			err = c.copy(name)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDir copies the files in dir starting with prefix, without subdirectories.
+func (c *fsCache) copyDir(dir, prefix string) error {
+	entries, err := fs.ReadDir(c.fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) {
+			if err := c.copy(path.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copy copies the file name of fsys to the cache directory once. Missing files are left to
+// Mapnik to report.
+func (c *fsCache) copy(name string) error {
+	if c.copied[name] {
+		return nil
+	}
+	r, err := c.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if st, err := r.Stat(); err != nil || st.IsDir() {
+		return err
+	}
+	target := filepath.Join(c.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	w, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	c.copied[name] = true
+	return nil
+}
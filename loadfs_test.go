@@ -0,0 +1,121 @@
+//go:build go1.16
+// +build go1.16
+
+package mapnik
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSCacheMaterialize(t *testing.T) {
+	fsys := fstest.MapFS{
+		"styles/map.xml":         {Data: []byte(`<Map font-directory="fonts"/>`)},
+		"styles/fonts/a.ttf":     {Data: []byte("a")},
+		"styles/fonts/sub/b.ttf": {Data: []byte("b")},
+		"styles/marker.svg":      {Data: []byte("<svg/>")},
+		"styles/unused.svg":      {Data: []byte("<svg/>")},
+		"data/roads.shp":         {Data: []byte("shp")},
+		"data/roads.dbf":         {Data: []byte("dbf")},
+		"data/roads.shx":         {Data: []byte("shx")},
+		"data/roadsides.shp":     {Data: []byte("shp")},
+	}
+	c, err := acquireFSCache(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []fileRef{
+		{file: "fonts", dir: true},
+		{file: "marker.svg"},
+		{file: "[icon].svg"},
+		{file: "missing.svg"},
+		{file: "/usr/share/icons/x.svg"},
+		{file: "../../outside.svg"},
+		{file: "roads", base: "../data", datasource: "shape"},
+	}
+	if err := c.materialize("styles", files); err != nil {
+		t.Fatal(err)
+	}
+	var copied []string
+	filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(c.dir, path)
+			copied = append(copied, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(copied)
+	expected := []string{"data/roads.dbf", "data/roads.shp", "data/roads.shx", "styles/fonts/a.ttf", "styles/marker.svg"}
+	assertEqual(t, expected, copied)
+
+	// fstest.MapFS is not comparable and not shared
+	c2, err := acquireFSCache(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 == c {
+		t.Error("unexpected shared cache")
+	}
+	c2.release()
+	c.release()
+	if _, err := os.Stat(c.dir); !os.IsNotExist(err) {
+		t.Error("cache directory not removed")
+	}
+}
+
+func TestFSCacheShared(t *testing.T) {
+	fsys := os.DirFS("test")
+	c1, err := acquireFSCache(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := acquireFSCache(os.DirFS("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 {
+		t.Error("cache not shared")
+	}
+	c1.release()
+	if _, err := os.Stat(c1.dir); err != nil {
+		t.Error("cache directory removed while in use")
+	}
+	c2.release()
+	if _, err := os.Stat(c1.dir); !os.IsNotExist(err) {
+		t.Error("cache directory not removed")
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := os.DirFS("test")
+	m := New()
+	if err := m.LoadFS(fsys, "map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	// the relative geojson files are found
+	if _, err := m.RenderImage(RenderOpts{}); err != nil {
+		t.Error(err)
+	}
+	m2 := New()
+	if err := m2.LoadFS(fsys, "map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	c := fsCaches.m[fsys]
+	if c == nil || c.refs != 2 {
+		t.Fatal("maps do not share the files", c)
+	}
+	m.Free()
+	m2.Free()
+	if _, err := os.Stat(c.dir); !os.IsNotExist(err) {
+		t.Error("temporary directory not removed", c.dir)
+	}
+
+	m = New()
+	defer m.Free()
+	if err := m.LoadFS(fsys, "../test/map.xml"); err == nil {
+		t.Error("invalid path did not return an error")
+	}
+}
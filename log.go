@@ -0,0 +1,91 @@
+package mapnik
+
+// #include <stdlib.h>
+// #include "mapnik_c_api.h"
+// extern void goMapnikLog(char *line);
+import "C"
+
+import (
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Warn:
+		return "warn"
+	case Error:
+		return "error"
+	}
+	return "none"
+}
+
+// LogRecord is a message of the Mapnik logger. Mapnik does not pass the level of single
+// messages to its log output, use LogSeverity and LogObjectSeverity to select the messages.
+type LogRecord struct {
+	// Source is the name of the logging object, e.g. "agg_renderer" or "shape", if the
+	// message is prefixed with it.
+	Source  string
+	Message string
+}
+
+var logHandler struct {
+	sync.RWMutex
+	fn func(LogRecord)
+}
+
+// SetLogHandler routes the output of the Mapnik logger to fn instead of stderr. fn is called
+// from rendering goroutines and must be safe for concurrent use. A nil fn restores the
+// output to stderr.
+//
+// Mapnik does not pass the severity of single messages to its log output, so records have
+// no level. LogSeverity and LogObjectSeverity select which messages reach fn.
+func SetLogHandler(fn func(LogRecord)) {
+	logHandler.Lock()
+	logHandler.fn = fn
+	logHandler.Unlock()
+	if fn == nil {
+		C.mapnik_logging_set_callback(nil)
+	} else {
+		C.mapnik_logging_set_callback(C.mapnik_log_callback_t(unsafe.Pointer(C.goMapnikLog)))
+	}
+}
+
+// LogObjectSeverity sets the log level for the messages of a single source, e.g. to see
+// debug messages of "agg_renderer" only.
+func LogObjectSeverity(source string, level LogLevel) {
+	cs := C.CString(source)
+	defer C.free(unsafe.Pointer(cs))
+	C.mapnik_logging_set_object_severity(cs, C.int(level))
+}
+
+//export goMapnikLog
+func goMapnikLog(line *C.char) {
+	logLine(C.GoString(line))
+}
+
+func logLine(line string) {
+	logHandler.RLock()
+	fn := logHandler.fn
+	logHandler.RUnlock()
+	if fn != nil {
+		fn(parseLogLine(line))
+	}
+}
+
+// parseLogLine splits a line like "shape: file not found" into source and message.
+func parseLogLine(line string) LogRecord {
+	r := LogRecord{Message: strings.TrimSpace(line)}
+	if i := strings.Index(r.Message, ": "); i > 0 {
+		source := r.Message[:i]
+		if strings.IndexFunc(source, func(c rune) bool {
+			return !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9')
+		}) < 0 {
+			r.Source, r.Message = source, r.Message[i+2:]
+		}
+	}
+	return r
+}
@@ -0,0 +1,28 @@
+//go:build go1.21
+// +build go1.21
+
+package mapnik
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SetLogger routes the output of the Mapnik logger to l, with the source of the message in
+// the attribute "object". Mapnik does not pass the severity of single messages to its log
+// output, so they cannot be mapped to slog levels: all messages are logged at
+// slog.LevelInfo. Use LogSeverity and LogObjectSeverity to select the messages. A nil l
+// restores the output to stderr.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		SetLogHandler(nil)
+		return
+	}
+	SetLogHandler(func(r LogRecord) {
+		attrs := []slog.Attr{}
+		if r.Source != "" {
+			attrs = append(attrs, slog.String("object", r.Source))
+		}
+		l.LogAttrs(context.Background(), slog.LevelInfo, r.Message, attrs...)
+	})
+}
@@ -0,0 +1,21 @@
+//go:build go1.21
+// +build go1.21
+
+package mapnik
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer SetLogger(nil)
+	logLine("shape: file not found")
+	if s := buf.String(); !strings.Contains(s, `level=INFO msg="file not found" object=shape`) {
+		t.Error("unexpected log output", s)
+	}
+}
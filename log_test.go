@@ -0,0 +1,30 @@
+package mapnik
+
+import "testing"
+
+func TestParseLogLine(t *testing.T) {
+	for _, tt := range []struct {
+		line     string
+		expected LogRecord
+	}{
+		{" shape: file not found", LogRecord{"shape", "file not found"}},
+		{"agg_renderer: Start map processing bbox=box2d(0,0,1,1)", LogRecord{"agg_renderer", "Start map processing bbox=box2d(0,0,1,1)"}},
+		{"Unable to find font: DejaVu Sans", LogRecord{"", "Unable to find font: DejaVu Sans"}},
+		{"no source", LogRecord{"", "no source"}},
+	} {
+		if r := parseLogLine(tt.line); r != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v", tt.line, tt.expected, r)
+		}
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var records []LogRecord
+	SetLogHandler(func(r LogRecord) { records = append(records, r) })
+	logLine("shape: file not found")
+	SetLogHandler(nil)
+	logLine("shape: not handled")
+	if len(records) != 1 || records[0] != (LogRecord{"shape", "file not found"}) {
+		t.Error("unexpected records", records)
+	}
+}
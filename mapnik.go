@@ -8,10 +8,15 @@ package mapnik
 import "C"
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
 	"unsafe"
 )
 
@@ -27,7 +32,9 @@ var (
 func init() {
 	// register default datasources path and fonts path like the python bindings do
 	RegisterDatasources(pluginPath)
-	RegisterFonts(fontPath)
+	cs := C.CString(fontPath)
+	C.mapnik_register_fonts(cs)
+	C.free(unsafe.Pointer(cs))
 }
 
 // RegisterDatasources adds path to the Mapnik plugin search path.
@@ -40,7 +47,11 @@ func RegisterDatasources(path string) error {
 	return nil
 }
 
-// RegisterFonts adds path to the Mapnik fonts search path.
+// RegisterFonts adds path to the Mapnik fonts search path. It does not report if no fonts
+// were found.
+//
+// Deprecated: Use RegisterFontFaces, which returns the added faces, can search
+// subdirectories and returns an error if no new fonts were found.
 func RegisterFonts(path string) error {
 	cs := C.CString(path)
 	defer C.free(unsafe.Pointer(cs))
@@ -76,9 +87,12 @@ func init() {
 // Datasource base type
 type Datasource struct {
 	ds *C.struct__mapnik_datasource_t
+	// err is the error of the Mapnik plugin, see Err
+	err error
 }
 
-// NewDatasource initializes a new Datasource
+// NewDatasource initializes a new Datasource. If the Mapnik plugin fails, e.g. for a missing
+// file, the datasource has no features and Err returns the error of the plugin.
 func NewDatasource(params map[string]string) *Datasource {
 	p := C.mapnik_parameters()
 	defer C.mapnik_parameters_free(p)
@@ -89,7 +103,202 @@ func NewDatasource(params map[string]string) *Datasource {
 		defer C.free(unsafe.Pointer(vcs))
 		C.mapnik_parameters_set(p, kcs, vcs)
 	}
-	return &Datasource{C.mapnik_datasource(p)}
+	ds := &Datasource{ds: C.mapnik_datasource(p)}
+	if C.mapnik_datasource_last_error(ds.ds) != nil {
+		ds.err = ds.lastError()
+	}
+	return ds
+}
+
+// Err returns the error of the Mapnik plugin when the datasource was created, or nil.
+func (ds *Datasource) Err() error {
+	return ds.err
+}
+
+// newDatasource initializes a new Datasource and returns the error of the Mapnik plugin, if any.
+func newDatasource(params map[string]string) (*Datasource, error) {
+	ds := NewDatasource(params)
+	if err := ds.Err(); err != nil {
+		ds.Free()
+		return nil, err
+	}
+	return ds, nil
+}
+
+// NewGeoJSONDatasource initializes a new Datasource with the GeoJSON read from r.
+func NewGeoJSONDatasource(r io.Reader) (*Datasource, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return FromGeoJSON(b)
+}
+
+// FromGeoJSON initializes a new Datasource with a GeoJSON FeatureCollection, Feature or geometry.
+func FromGeoJSON(b []byte) (*Datasource, error) {
+	var obj struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, fmt.Errorf("mapnik: invalid GeoJSON: %v", err)
+	}
+	if obj.Type == "" {
+		return nil, errors.New("mapnik: invalid GeoJSON: missing type")
+	}
+	return newDatasource(map[string]string{"type": "geojson", "inline": string(b)})
+}
+
+// Feature is a geometry with attributes.
+type Feature struct {
+	// ID of the feature. Defaults to the position of the feature, starting with 1.
+	ID       int64
+	Geometry Geometry
+	// Properties are the attributes of the feature. Values can be nil, strings, bools, ints and floats.
+	Properties map[string]interface{}
+}
+
+// NewMemoryDatasource initializes a new Datasource with the given features.
+func NewMemoryDatasource(features []Feature) (*Datasource, error) {
+	ds := &Datasource{ds: C.mapnik_memory_datasource()}
+	for i, f := range features {
+		if err := ds.push(i, f); err != nil {
+			ds.Free()
+			return nil, err
+		}
+	}
+	return ds, nil
+}
+
+func (ds *Datasource) push(i int, f Feature) error {
+	id := f.ID
+	if id == 0 {
+		id = int64(i + 1)
+	}
+	if f.Geometry == nil {
+		return fmt.Errorf("mapnik: feature %d without geometry", id)
+	}
+	wkb := f.Geometry.appendWKB(nil)
+	cf := C.mapnik_feature(C.longlong(id), (*C.char)(unsafe.Pointer(&wkb[0])), C.size_t(len(wkb)))
+	if cf == nil {
+		return fmt.Errorf("mapnik: invalid geometry for feature %d", id)
+	}
+	defer C.mapnik_feature_free(cf)
+	for k, v := range f.Properties {
+		if err := putProperty(cf, k, v); err != nil {
+			return fmt.Errorf("mapnik: feature %d: %v", id, err)
+		}
+	}
+	C.mapnik_memory_datasource_push(ds.ds, cf)
+	return nil
+}
+
+func putProperty(f *C.mapnik_feature_t, k string, v interface{}) error {
+	kcs := C.CString(k)
+	defer C.free(unsafe.Pointer(kcs))
+	switch v := v.(type) {
+	case nil:
+		C.mapnik_feature_put_null(f, kcs)
+	case string:
+		vcs := C.CString(v)
+		defer C.free(unsafe.Pointer(vcs))
+		C.mapnik_feature_put_string(f, kcs, vcs)
+	case bool:
+		b := 0
+		if v {
+			b = 1
+		}
+		C.mapnik_feature_put_bool(f, kcs, C.int(b))
+	case int:
+		C.mapnik_feature_put_int(f, kcs, C.longlong(v))
+	case int32:
+		C.mapnik_feature_put_int(f, kcs, C.longlong(v))
+	case int64:
+		C.mapnik_feature_put_int(f, kcs, C.longlong(v))
+	case uint32:
+		C.mapnik_feature_put_int(f, kcs, C.longlong(v))
+	case float32:
+		C.mapnik_feature_put_double(f, kcs, C.double(v))
+	case float64:
+		C.mapnik_feature_put_double(f, kcs, C.double(v))
+	default:
+		return fmt.Errorf("unsupported type %T of property %q", v, k)
+	}
+	return nil
+}
+
+func (ds *Datasource) lastError() error {
+	return errors.New("mapnik: " + C.GoString(C.mapnik_datasource_last_error(ds.ds)))
+}
+
+// Features returns all features of the datasource within the bounding box. The bounding box
+// and the returned geometries are in the projection of the datasource. Requires Mapnik 3.
+func (ds *Datasource) Features(minx, miny, maxx, maxy float64) ([]Feature, error) {
+	bbox := C.mapnik_bbox(C.double(minx), C.double(miny), C.double(maxx), C.double(maxy))
+	defer C.mapnik_bbox_free(bbox)
+	fs := C.mapnik_datasource_features(ds.ds, bbox)
+	if fs == nil {
+		return nil, ds.lastError()
+	}
+	return collectFeatures(fs)
+}
+
+// collectFeatures converts and frees all features of the featureset.
+func collectFeatures(fs *C.mapnik_featureset_t) ([]Feature, error) {
+	defer C.mapnik_featureset_free(fs)
+
+	features := []Feature{}
+	for {
+		f := C.mapnik_featureset_next(fs)
+		if f == nil {
+			if err := C.mapnik_featureset_last_error(fs); err != nil {
+				return nil, errors.New("mapnik: " + C.GoString(err))
+			}
+			return features, nil
+		}
+		feature, err := goFeature(f)
+		C.mapnik_feature_free(f)
+		if err != nil {
+			return nil, err
+		}
+		features = append(features, feature)
+	}
+}
+
+// goFeature converts a Mapnik feature into a Feature.
+func goFeature(f *C.mapnik_feature_t) (Feature, error) {
+	feature := Feature{ID: int64(C.mapnik_feature_id(f))}
+
+	size := C.size_t(0)
+	wkb := C.mapnik_feature_geometry_wkb(f, &size)
+	if wkb != nil {
+		b := C.GoBytes(unsafe.Pointer(wkb), C.int(size))
+		C.mapnik_wkb_free(wkb)
+		g, err := UnmarshalWKB(b)
+		if err != nil {
+			return feature, fmt.Errorf("mapnik: feature %d: %v", feature.ID, err)
+		}
+		feature.Geometry = g
+	}
+
+	n := int(C.mapnik_feature_attribute_count(f))
+	feature.Properties = make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		idx := C.int(i)
+		name := C.GoString(C.mapnik_feature_attribute_name(f, idx))
+		switch C.mapnik_feature_attribute_type(f, idx) {
+		case C.MAPNIK_VALUE_BOOL:
+			feature.Properties[name] = C.mapnik_feature_attribute_bool(f, idx) != 0
+		case C.MAPNIK_VALUE_INT:
+			feature.Properties[name] = int64(C.mapnik_feature_attribute_int(f, idx))
+		case C.MAPNIK_VALUE_DOUBLE:
+			feature.Properties[name] = float64(C.mapnik_feature_attribute_double(f, idx))
+		case C.MAPNIK_VALUE_STRING:
+			feature.Properties[name] = C.GoString(C.mapnik_feature_attribute_string(f, idx))
+		default:
+			feature.Properties[name] = nil
+		}
+	}
+	return feature, nil
 }
 
 // Free deallocates the datasource.
@@ -125,7 +334,8 @@ func (l *Layer) AddStyle(stylename string) {
 	C.mapnik_layer_add_style(l.l, cs)
 }
 
-// SetDatasource sets the datasource.
+// SetDatasource sets the datasource. A datasource whose plugin failed leaves the layer
+// without features, check Datasource.Err before.
 func (l *Layer) SetDatasource(ds *Datasource) {
 	C.mapnik_layer_set_datasource(l.l, ds.ds)
 }
@@ -136,6 +346,10 @@ type Map struct {
 	width       int
 	height      int
 	layerStatus []bool
+	// onFree are called by Free, see LoadFS
+	onFree []func()
+	// fontSets are the fontsets added with AddFontSet
+	fontSets map[string][]string
 }
 
 // New initializes a new Map.
@@ -153,9 +367,17 @@ func (m *Map) lastError() error {
 
 // Load reads in a Mapnik map XML.
 func (m *Map) Load(stylesheet string) error {
+	if len(m.fontSets) > 0 {
+		// load from a string to make the added fontsets available to the stylesheet
+		b, err := ioutil.ReadFile(stylesheet)
+		if err != nil {
+			return errors.New("mapnik: " + err.Error())
+		}
+		return m.LoadString(string(b), filepath.Dir(stylesheet))
+	}
 	cs := C.CString(stylesheet)
 	defer C.free(unsafe.Pointer(cs))
-	if C.mapnik_map_load(m.m, cs) != 0 {
+	if C.mapnik_map_load(m.m, cs, 0) != 0 {
 		return m.lastError()
 	}
 	return nil
@@ -163,11 +385,22 @@ func (m *Map) Load(stylesheet string) error {
 
 // LoadString reads in a Mapnik map from a XML string.
 func (m *Map) LoadString(s string, basePath string) error {
+	return m.loadString(s, basePath, false)
+}
+
+func (m *Map) loadString(s string, basePath string, strict bool) error {
+	if len(m.fontSets) > 0 {
+		s = withFontSets(s, m.fontSets)
+	}
 	cs := C.CString(s)
 	defer C.free(unsafe.Pointer(cs))
 	bs := C.CString(basePath)
 	defer C.free(unsafe.Pointer(bs))
-	if C.mapnik_map_load_string(m.m, cs, bs) != 0 {
+	st := 0
+	if strict {
+		st = 1
+	}
+	if C.mapnik_map_load_string(m.m, cs, bs, C.int(st)) != 0 {
 		return m.lastError()
 	}
 	return nil
@@ -184,6 +417,10 @@ func (m *Map) Resize(width, height int) {
 func (m *Map) Free() {
 	C.mapnik_map_free(m.m)
 	m.m = nil
+	for _, fn := range m.onFree {
+		fn()
+	}
+	m.onFree = nil
 }
 
 // SRS returns the projection of the map.
@@ -255,6 +492,137 @@ func (m *Map) ZoomTo(minx, miny, maxx, maxy float64) {
 	C.mapnik_map_zoom_to_box(m.m, bbox)
 }
 
+const (
+	// pixelSize is the standardized rendering pixel size of 0.28mm (OGC SLD/WMS).
+	pixelSize = 0.00028
+	// metersPerDegree is the length of one degree at the equator of the WGS84 ellipsoid.
+	metersPerDegree = 6378137 * 2 * math.Pi / 360
+	// zoomLevel0Scale is the scale denominator of zoom level 0 of 256x256 pixel web mercator tiles.
+	zoomLevel0Scale = 559082264.0287178
+)
+
+// ZoomToCenter zooms to the given scale denominator, centered at x/y in map units.
+func (m *Map) ZoomToCenter(x, y, scaleDenominator float64) error {
+	p, err := m.Projection()
+	if err != nil {
+		return err
+	}
+	defer p.Free()
+	res := scaleDenominator * pixelSize
+	if p.IsGeographic() {
+		res /= metersPerDegree
+	}
+	w := res * float64(m.width) / 2
+	h := res * float64(m.height) / 2
+	m.ZoomTo(x-w, y-h, x+w, y+h)
+	return nil
+}
+
+// ZoomToZoomLevel zooms to the scale of the web mercator zoom level z, centered at lon/lat.
+func (m *Map) ZoomToZoomLevel(lon, lat float64, z int) error {
+	p, err := m.Projection()
+	if err != nil {
+		return err
+	}
+	c := p.Forward(Coord{lon, lat})
+	p.Free()
+	return m.ZoomToCenter(c.X, c.Y, zoomLevel0Scale/math.Pow(2, float64(z)))
+}
+
+// ZoomToLonLat zooms to the longitude/latitude bounding box, with a padding in pixel around it.
+func (m *Map) ZoomToLonLat(minLon, minLat, maxLon, maxLat float64, padding int) error {
+	w := float64(m.width - 2*padding)
+	h := float64(m.height - 2*padding)
+	if w <= 0 || h <= 0 {
+		return errors.New("mapnik: padding exceeds map size")
+	}
+	p, err := m.Projection()
+	if err != nil {
+		return err
+	}
+	defer p.Free()
+	minx, miny := math.Inf(1), math.Inf(1)
+	maxx, maxy := math.Inf(-1), math.Inf(-1)
+	for _, c := range []Coord{{minLon, minLat}, {minLon, maxLat}, {maxLon, minLat}, {maxLon, maxLat}} {
+		c = p.Forward(c)
+		minx, miny = math.Min(minx, c.X), math.Min(miny, c.Y)
+		maxx, maxy = math.Max(maxx, c.X), math.Max(maxy, c.Y)
+	}
+	pad := float64(padding) * math.Max((maxx-minx)/w, (maxy-miny)/h)
+	m.ZoomTo(minx-pad, miny-pad, maxx+pad, maxy+pad)
+	return nil
+}
+
+// Pan moves the center of the current extent by dx/dy pixel. Positive values move right and down.
+func (m *Map) Pan(dx, dy int) {
+	C.mapnik_map_pan(m.m, C.int(dx), C.int(dy))
+}
+
+// ZoomBy scales the current extent by factor around its center. Values > 1 zoom out, values < 1 zoom in.
+func (m *Map) ZoomBy(factor float64) {
+	C.mapnik_map_zoom(m.m, C.double(factor))
+}
+
+// CurrentExtent returns the bounding box of the current extent in map units.
+func (m *Map) CurrentExtent() (minx, miny, maxx, maxy float64) {
+	C.mapnik_map_get_current_extent(m.m,
+		(*C.double)(&minx), (*C.double)(&miny), (*C.double)(&maxx), (*C.double)(&maxy))
+	return
+}
+
+// Coord is a x/y coordinate pair.
+type Coord struct {
+	X, Y float64
+}
+
+// Projection transforms coordinates between WGS84 (longitude/latitude) and another projection.
+type Projection struct {
+	p *C.struct__mapnik_projection_t
+}
+
+// NewProjection initializes a projection from a proj4 string like "+init=epsg:3857". Call Free when done.
+func NewProjection(srs string) (*Projection, error) {
+	cs := C.CString(srs)
+	defer C.free(unsafe.Pointer(cs))
+	p := C.mapnik_projection(cs)
+	if p == nil {
+		return nil, fmt.Errorf("mapnik: invalid projection %q", srs)
+	}
+	return &Projection{p}, nil
+}
+
+// Projection returns the projection of the map. Call Free when done.
+func (m *Map) Projection() (*Projection, error) {
+	p := C.mapnik_map_projection(m.m)
+	if p == nil {
+		return nil, m.lastError()
+	}
+	return &Projection{p}, nil
+}
+
+// Free deallocates the projection.
+func (p *Projection) Free() {
+	C.mapnik_projection_free(p.p)
+	p.p = nil
+}
+
+// Forward transforms a longitude/latitude coordinate into the projection.
+func (p *Projection) Forward(c Coord) Coord {
+	r := C.mapnik_projection_forward(p.p, C.mapnik_coord_t{C.double(c.X), C.double(c.Y)})
+	return Coord{float64(r.x), float64(r.y)}
+}
+
+// Inverse transforms a coordinate of the projection into longitude/latitude.
+func (p *Projection) Inverse(c Coord) Coord {
+	r := C.mapnik_projection_inverse(p.p, C.mapnik_coord_t{C.double(c.X), C.double(c.Y)})
+	return Coord{float64(r.x), float64(r.y)}
+}
+
+// IsGeographic returns whether the projection uses degrees as units.
+func (p *Projection) IsGeographic() bool {
+	return C.mapnik_projection_is_geographic(p.p) == 1
+}
+
 func (m *Map) BackgroundColor() color.NRGBA {
 	c := color.NRGBA{}
 	C.mapnik_map_background(m.m, (*C.uint8_t)(&c.R), (*C.uint8_t)(&c.G), (*C.uint8_t)(&c.B), (*C.uint8_t)(&c.A))
@@ -339,6 +707,66 @@ func (m *Map) AddLayer(l *Layer) {
 	C.mapnik_map_add_layer(m.m, l.l)
 }
 
+// RemoveLayer removes all layers with the given name.
+func (m *Map) RemoveLayer(name string) {
+	for i := m.CountLayers() - 1; i >= 0; i-- {
+		if C.GoString(C.mapnik_map_layer_name(m.m, C.size_t(i))) != name {
+			continue
+		}
+		C.mapnik_map_remove_layer(m.m, C.size_t(i))
+		if i < len(m.layerStatus) {
+			m.layerStatus = append(m.layerStatus[:i], m.layerStatus[i+1:]...)
+		}
+	}
+}
+
+// LayerQuery selects features of a map layer.
+type LayerQuery struct {
+	// BBox limits the features to minx, miny, maxx, maxy in the projection of the map.
+	// Returns all features of the layer if nil.
+	BBox *[4]float64
+	// Filter is a Mapnik expression like in the Filter element of a style rule,
+	// e.g. "[highway] = 'primary' and [lanes] > 2".
+	Filter string
+	// SRS is the projection of the returned geometries. Defaults to the projection of the map.
+	SRS string
+}
+
+// LayerFeatures returns the features of the first layer with the given name. Requires Mapnik 3.
+func (m *Map) LayerFeatures(name string, q LayerQuery) ([]Feature, error) {
+	for i := 0; i < m.CountLayers(); i++ {
+		if C.GoString(C.mapnik_map_layer_name(m.m, C.size_t(i))) == name {
+			return m.layerFeatures(i, q)
+		}
+	}
+	return nil, fmt.Errorf("mapnik: unknown layer %q", name)
+}
+
+func (m *Map) layerFeatures(idx int, q LayerQuery) ([]Feature, error) {
+	var bbox *C.mapnik_bbox_t
+	if q.BBox != nil {
+		bbox = C.mapnik_bbox(C.double(q.BBox[0]), C.double(q.BBox[1]), C.double(q.BBox[2]), C.double(q.BBox[3]))
+		defer C.mapnik_bbox_free(bbox)
+	}
+	cfilter := C.CString(q.Filter)
+	defer C.free(unsafe.Pointer(cfilter))
+	csrs := C.CString(q.SRS)
+	defer C.free(unsafe.Pointer(csrs))
+
+	fs := C.mapnik_map_layer_features(m.m, C.size_t(idx), bbox, cfilter, csrs)
+	if fs == nil {
+		return nil, m.lastError()
+	}
+	return collectFeatures(fs)
+}
+
+// RemoveStyle removes the style with the given name.
+func (m *Map) RemoveStyle(name string) {
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	C.mapnik_map_remove_style(m.m, cs)
+}
+
 // SelectLayers enables/disables single layers. LayerSelector or SelectorFunc gets called for each layer.
 func (m *Map) SelectLayers(selector LayerSelector) {
 	m.storeLayerStatus()
@@ -373,6 +801,139 @@ func (m *Map) ResetMaxExtent() {
 	C.mapnik_map_reset_maximum_extent(m.m)
 }
 
+// MaxExtent returns the maximum extent of the map in map units and whether it is set.
+func (m *Map) MaxExtent() (bbox [4]float64, ok bool) {
+	ok = C.mapnik_map_get_maximum_extent(m.m,
+		(*C.double)(&bbox[0]), (*C.double)(&bbox[1]), (*C.double)(&bbox[2]), (*C.double)(&bbox[3])) != 0
+	return bbox, ok
+}
+
+// Parameters returns the parameters of the map, e.g. from the <Parameters> block of a
+// stylesheet. Values are string, int64, float64 or bool, depending on the type attribute of
+// the parameter. Parameters without value are nil.
+func (m *Map) Parameters() map[string]interface{} {
+	p := C.mapnik_map_get_parameters(m.m)
+	defer C.mapnik_parameters_free(p)
+	params := make(map[string]interface{}, int(C.mapnik_parameters_count(p)))
+	for idx := 0; ; idx++ {
+		var key, s *C.char
+		var i C.longlong
+		var d C.double
+		var v interface{}
+		switch C.mapnik_parameters_get(p, C.size_t(idx), &key, &i, &d, &s) {
+		case -1:
+			return params
+		case C.MAPNIK_PARAMETER_INT:
+			v = int64(i)
+		case C.MAPNIK_PARAMETER_DOUBLE:
+			v = float64(d)
+		case C.MAPNIK_PARAMETER_STRING:
+			v = C.GoString(s)
+		case C.MAPNIK_PARAMETER_BOOL:
+			v = i != 0
+		}
+		params[C.GoString(key)] = v
+	}
+}
+
+// SetParameter sets the map parameter key to a string, integer, float or bool value.
+func (m *Map) SetParameter(key string, value interface{}) error {
+	p := C.mapnik_map_get_parameters(m.m)
+	defer C.mapnik_parameters_free(p)
+	if err := setParameter(p, key, value); err != nil {
+		return err
+	}
+	C.mapnik_map_set_parameters(m.m, p)
+	return nil
+}
+
+func setParameter(p *C.mapnik_parameters_t, key string, value interface{}) error {
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	switch v := value.(type) {
+	case string:
+		cv := C.CString(v)
+		defer C.free(unsafe.Pointer(cv))
+		C.mapnik_parameters_set(p, ckey, cv)
+	case int:
+		C.mapnik_parameters_set_int(p, ckey, C.longlong(v))
+	case int32:
+		C.mapnik_parameters_set_int(p, ckey, C.longlong(v))
+	case int64:
+		C.mapnik_parameters_set_int(p, ckey, C.longlong(v))
+	case float32:
+		C.mapnik_parameters_set_double(p, ckey, C.double(v))
+	case float64:
+		C.mapnik_parameters_set_double(p, ckey, C.double(v))
+	case bool:
+		var b C.int
+		if v {
+			b = 1
+		}
+		C.mapnik_parameters_set_bool(p, ckey, b)
+	default:
+		return fmt.Errorf("mapnik: unsupported type %T of parameter %s", value, key)
+	}
+	return nil
+}
+
+// newParameters converts vars into parameters, or returns nil if vars is empty.
+// Call mapnik_parameters_free when done.
+func newParameters(vars map[string]interface{}) (*C.mapnik_parameters_t, error) {
+	if len(vars) == 0 {
+		return nil, nil
+	}
+	p := C.mapnik_parameters()
+	for k, v := range vars {
+		if err := setParameter(p, k, v); err != nil {
+			C.mapnik_parameters_free(p)
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// parameter returns the map parameter key formatted as string.
+func (m *Map) parameter(key string) (string, bool) {
+	v, ok := m.Parameters()[key]
+	if !ok || v == nil {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+func (m *Map) layerSRS(idx int) string {
+	return C.GoString(C.mapnik_map_layer_srs(m.m, C.size_t(idx)))
+}
+
+// layerScaleDenominators returns the scale denominator range in which the layer is visible.
+func (m *Map) layerScaleDenominators(idx int) (min, max float64) {
+	C.mapnik_map_layer_scale_denominators(m.m, C.size_t(idx), (*C.double)(&min), (*C.double)(&max))
+	return min, max
+}
+
+// layerVisible returns whether the layer is active and visible at the scale denominator.
+func (m *Map) layerVisible(idx int, scale float64) bool {
+	if C.mapnik_map_layer_is_active(m.m, C.size_t(idx)) == 0 {
+		return false
+	}
+	// the same tolerance as mapnik::layer::visible
+	min, max := m.layerScaleDenominators(idx)
+	return scale >= min-1e-6 && scale < max+1e-6
+}
+
+// layerEnvelope returns the extent of the layer datasource in the projection of the layer.
+func (m *Map) layerEnvelope(idx int) (bbox [4]float64, ok bool, err error) {
+	switch C.mapnik_map_layer_envelope(m.m, C.size_t(idx),
+		(*C.double)(&bbox[0]), (*C.double)(&bbox[1]), (*C.double)(&bbox[2]), (*C.double)(&bbox[3])) {
+	case -1:
+		return bbox, false, m.lastError()
+	case 0:
+		return bbox, false, nil
+	}
+	return bbox, true, nil
+}
+
 // RenderOpts defines rendering options.
 type RenderOpts struct {
 	// Scale renders the map at a fixed scale denominator.
@@ -381,6 +942,10 @@ type RenderOpts struct {
 	ScaleFactor float64
 	// Format for the rendered image ('jpeg80', 'png256', etc. see: https://github.com/mapnik/mapnik/wiki/Image-IO)
 	Format string
+	// Variables are available in expressions of the stylesheet as [@name], e.g. to render
+	// language variants or to highlight a feature. Values are strings, integers, floats or
+	// bools. Requires Mapnik 3.
+	Variables map[string]interface{}
 }
 
 // Render returns the map as an encoded image.
@@ -389,7 +954,12 @@ func (m *Map) Render(opts RenderOpts) ([]byte, error) {
 	if scaleFactor == 0.0 {
 		scaleFactor = 1.0
 	}
-	i := C.mapnik_map_render_to_image(m.m, C.double(opts.Scale), C.double(scaleFactor))
+	vars, err := newParameters(opts.Variables)
+	if err != nil {
+		return nil, err
+	}
+	defer C.mapnik_parameters_free(vars)
+	i := C.mapnik_map_render_to_image(m.m, C.double(opts.Scale), C.double(scaleFactor), vars)
 	if i == nil {
 		return nil, m.lastError()
 	}
@@ -420,7 +990,12 @@ func (m *Map) RenderImage(opts RenderOpts) (*image.NRGBA, error) {
 	if scaleFactor == 0.0 {
 		scaleFactor = 1.0
 	}
-	i := C.mapnik_map_render_to_image(m.m, C.double(opts.Scale), C.double(scaleFactor))
+	vars, err := newParameters(opts.Variables)
+	if err != nil {
+		return nil, err
+	}
+	defer C.mapnik_parameters_free(vars)
+	i := C.mapnik_map_render_to_image(m.m, C.double(opts.Scale), C.double(scaleFactor), vars)
 	if i == nil {
 		return nil, m.lastError()
 	}
@@ -451,7 +1026,12 @@ func (m *Map) RenderToFile(opts RenderOpts, path string) error {
 		format = C.CString("png256")
 	}
 	defer C.free(unsafe.Pointer(format))
-	if C.mapnik_map_render_to_file(m.m, cs, C.double(opts.Scale), C.double(scaleFactor), format) != 0 {
+	vars, err := newParameters(opts.Variables)
+	if err != nil {
+		return err
+	}
+	defer C.mapnik_parameters_free(vars)
+	if C.mapnik_map_render_to_file(m.m, cs, C.double(opts.Scale), C.double(scaleFactor), format, vars) != 0 {
 		return m.lastError()
 	}
 	return nil
@@ -12,6 +12,12 @@
 #include <mapnik/datasource.hpp>
 #include <mapnik/datasource_cache.hpp>
 #include <mapnik/font_engine_freetype.hpp>
+#include <mapnik/projection.hpp>
+#include <mapnik/memory_datasource.hpp>
+#include <mapnik/feature_factory.hpp>
+#include <mapnik/unicode.hpp>
+#include <mapnik/wkb.hpp>
+#include <mapnik/font_set.hpp>
 
 
 #if MAPNIK_VERSION < 300000
@@ -20,11 +26,32 @@
 
 #ifdef MAPNIK_2
 #include <mapnik/graphics.hpp>
+#else
+#include <mapnik/util/geometry_to_wkb.hpp>
+#include <mapnik/geometry_reprojection.hpp>
+#include <mapnik/expression.hpp>
+#include <mapnik/expression_evaluator.hpp>
+#include <mapnik/proj_transform.hpp>
+#include <mapnik/attribute.hpp>
+#include <mapnik/symbolizer.hpp>
+#include <mapnik/text/placements/base.hpp>
+#include <mapnik/text/placements/list.hpp>
+#include <mapnik/text/formatting/format.hpp>
+#include <mapnik/text/formatting/layout.hpp>
+#include <mapnik/text/formatting/list.hpp>
 #endif
 
 #include "mapnik_c_api.h"
 
 #include <stdlib.h>
+#include <iostream>
+#include <set>
+
+#ifdef MAPNIK_2
+#include <boost/thread/mutex.hpp>
+#else
+#include <mutex>
+#endif
 
 #ifdef __cplusplus
 extern "C"
@@ -53,6 +80,25 @@ inline void mapnik_register_reset_last_error() {
     }
 }
 
+struct _mapnik_strings_t {
+    std::vector<std::string> v;
+};
+
+size_t mapnik_strings_count(mapnik_strings_t *s) {
+    return s ? s->v.size() : 0;
+}
+
+const char * mapnik_strings_get(mapnik_strings_t *s, size_t idx) {
+    if (s && idx < s->v.size()) {
+        return s->v[idx].c_str();
+    }
+    return NULL;
+}
+
+void mapnik_strings_free(mapnik_strings_t *s) {
+    delete s;
+}
+
 int mapnik_register_datasources(const char* path) {
     mapnik_register_reset_last_error();
     try {
@@ -68,6 +114,64 @@ int mapnik_register_datasources(const char* path) {
     }
 }
 
+mapnik_strings_t * mapnik_plugin_names() {
+    mapnik_strings_t *s = new mapnik_strings_t;
+#if MAPNIK_VERSION >= 200200
+    s->v = mapnik::datasource_cache::instance().plugin_names();
+#else
+    s->v = mapnik::datasource_cache::instance()->plugin_names();
+#endif
+    return s;
+}
+
+mapnik_strings_t * mapnik_plugin_directories() {
+#if MAPNIK_VERSION >= 200200
+    std::string dirs = mapnik::datasource_cache::instance().plugin_directories();
+#else
+    std::string dirs = mapnik::datasource_cache::instance()->plugin_directories();
+#endif
+    // the directories are joined with ", "
+    mapnik_strings_t *s = new mapnik_strings_t;
+    std::string::size_type start = 0;
+    while (start < dirs.size()) {
+        std::string::size_type end = dirs.find(", ", start);
+        if (end == std::string::npos) {
+            end = dirs.size();
+        }
+        if (end > start) {
+            s->v.push_back(dirs.substr(start, end - start));
+        }
+        start = end + 2;
+    }
+    return s;
+}
+
+int mapnik_features() {
+    int features = 0;
+#ifdef HAVE_PNG
+    features |= MAPNIK_FEATURE_PNG;
+#endif
+#ifdef HAVE_JPEG
+    features |= MAPNIK_FEATURE_JPEG;
+#endif
+#ifdef HAVE_WEBP
+    features |= MAPNIK_FEATURE_WEBP;
+#endif
+#ifdef HAVE_TIFF
+    features |= MAPNIK_FEATURE_TIFF;
+#endif
+#ifdef HAVE_CAIRO
+    features |= MAPNIK_FEATURE_CAIRO;
+#endif
+#ifdef GRID_RENDERER
+    features |= MAPNIK_FEATURE_GRID;
+#endif
+#if defined(MAPNIK_USE_PROJ4) || defined(MAPNIK_USE_PROJ)
+    features |= MAPNIK_FEATURE_PROJ;
+#endif
+    return features;
+}
+
 int mapnik_register_fonts(const char* path) {
     mapnik_register_reset_last_error();
     try {
@@ -86,25 +190,154 @@ const char *mapnik_register_last_error() {
     return NULL;
 }
 
-void mapnik_logging_set_severity(int level) {
-    mapnik::logger::severity_type severity;
+mapnik_strings_t * mapnik_font_faces() {
+    mapnik_strings_t *s = new mapnik_strings_t;
+    s->v = mapnik::freetype_engine::face_names();
+    return s;
+}
+
+const char * mapnik_font_file(const char *face) {
+#ifdef MAPNIK_2
+    return NULL;
+#else
+    mapnik::freetype_engine::font_file_mapping_type const& mapping = mapnik::freetype_engine::get_mapping();
+    mapnik::freetype_engine::font_file_mapping_type::const_iterator it = mapping.find(face);
+    if (it == mapping.end()) {
+        return NULL;
+    }
+    return it->second.second.c_str();
+#endif
+}
+
+mapnik_strings_t * mapnik_register_font_faces(const char *path, int recursive) {
+    mapnik_register_reset_last_error();
+    try {
+        std::vector<std::string> before = mapnik::freetype_engine::face_names();
+        std::set<std::string> known(before.begin(), before.end());
+        mapnik::freetype_engine::register_fonts(path, recursive != 0);
+        std::vector<std::string> after = mapnik::freetype_engine::face_names();
+        mapnik_strings_t *s = new mapnik_strings_t;
+        for (std::vector<std::string>::const_iterator it = after.begin(); it != after.end(); ++it) {
+            if (known.find(*it) == known.end()) {
+                s->v.push_back(*it);
+            }
+        }
+        return s;
+    } catch (std::exception const& ex) {
+        register_err = new std::string(ex.what());
+        return NULL;
+    }
+}
+
+static mapnik::logger::severity_type to_severity(int level) {
     switch (level) {
     case MAPNIK_DEBUG:
-        severity = mapnik::logger::debug;
-        break;
+        return mapnik::logger::debug;
     case MAPNIK_WARN:
-        severity = mapnik::logger::warn;
-        break;
+        return mapnik::logger::warn;
     case MAPNIK_ERROR:
-        severity = mapnik::logger::error;
-        break;
+        return mapnik::logger::error;
     default:
-        severity = mapnik::logger::none;
-        break;
+        return mapnik::logger::none;
     }
-    mapnik::logger::instance().set_severity(severity);
 }
 
+void mapnik_logging_set_severity(int level) {
+    mapnik::logger::instance().set_severity(to_severity(level));
+}
+
+void mapnik_logging_set_object_severity(const char *name, int level) {
+    mapnik::logger::instance().set_object_severity(name, to_severity(level));
+}
+
+#ifdef MAPNIK_2
+typedef boost::mutex log_mutex_t;
+typedef boost::mutex::scoped_lock log_lock_t;
+#else
+typedef std::mutex log_mutex_t;
+typedef std::lock_guard<std::mutex> log_lock_t;
+#endif
+
+// log_callback_buf passes each line written to std::clog to a callback, or to the previous
+// buffer of std::clog if no callback is set. It is installed once and never freed, as other
+// threads may write to std::clog at any time.
+class log_callback_buf : public std::streambuf {
+public:
+    explicit log_callback_buf(std::streambuf *prev) : cb_(NULL), prev_(prev) {}
+
+    void set_callback(mapnik_log_callback_t cb) {
+        log_lock_t lock(mutex_);
+        cb_ = cb;
+    }
+
+protected:
+    int overflow(int c) {
+        log_lock_t lock(mutex_);
+        put(c);
+        return c;
+    }
+
+    std::streamsize xsputn(const char *s, std::streamsize n) {
+        log_lock_t lock(mutex_);
+        for (std::streamsize i = 0; i < n; i++) {
+            put(s[i]);
+        }
+        return n;
+    }
+
+private:
+    void put(int c) {
+        if (c == EOF) {
+            return;
+        }
+        if (c != '\n') {
+            line_ += static_cast<char>(c);
+            return;
+        }
+        if (cb_) {
+            if (!line_.empty()) {
+                cb_(line_.c_str());
+            }
+        } else {
+            line_ += '\n';
+            prev_->sputn(line_.data(), line_.size());
+            prev_->pubsync();
+        }
+        line_.clear();
+    }
+
+    log_mutex_t mutex_;
+    mapnik_log_callback_t cb_;
+    std::streambuf *prev_;
+    std::string line_;
+};
+
+static log_mutex_t log_callback_mutex;
+static log_callback_buf *log_buf = NULL;
+static bool log_callback_set = false;
+static std::string log_format;
+
+void mapnik_logging_set_callback(mapnik_log_callback_t cb) {
+    log_lock_t lock(log_callback_mutex);
+    if (!log_buf) {
+        log_buf = new log_callback_buf(std::clog.rdbuf());
+        std::clog.rdbuf(log_buf);
+    }
+    if (cb && !log_callback_set) {
+        // the callback gets the bare messages without time stamp
+        log_format = mapnik::logger::get_format();
+        mapnik::logger::set_format("");
+    } else if (!cb && log_callback_set) {
+        mapnik::logger::set_format(log_format);
+    }
+    log_callback_set = cb != NULL;
+    log_buf->set_callback(cb);
+}
+
+struct _mapnik_parameters_t {
+    mapnik::parameters *p;
+};
+
 struct _mapnik_map_t {
     mapnik::Map * m;
     std::string * err;
@@ -173,11 +406,11 @@ double mapnik_map_get_scale_denominator(mapnik_map_t * m) {
     return 0.0;
 }
 
-int mapnik_map_load(mapnik_map_t * m, const char* stylesheet) {
+int mapnik_map_load(mapnik_map_t * m, const char* stylesheet, int strict) {
     mapnik_map_reset_last_error(m);
     if (m && m->m) {
         try {
-            mapnik::load_map(*m->m, stylesheet);
+            mapnik::load_map(*m->m, stylesheet, strict != 0);
         } catch (std::exception const& ex) {
             m->err = new std::string(ex.what());
             return -1;
@@ -187,11 +420,11 @@ int mapnik_map_load(mapnik_map_t * m, const char* stylesheet) {
     return -1;
 }
 
-int mapnik_map_load_string(mapnik_map_t *m, const char* s, const char* base_path) {
+int mapnik_map_load_string(mapnik_map_t *m, const char* s, const char* base_path, int strict) {
     mapnik_map_reset_last_error(m);
     if (m && m->m) {
         try {
-            mapnik::load_map_string(*(m->m), s, 0, std::string(base_path));
+            mapnik::load_map_string(*(m->m), s, strict != 0, std::string(base_path));
         } catch (std::exception const& ex) {
             m->err = new std::string(ex.what());
             return -1;
@@ -257,6 +490,89 @@ void mapnik_map_zoom_to_box(mapnik_map_t * m, mapnik_bbox_t * b) {
     }
 }
 
+void mapnik_map_zoom(mapnik_map_t * m, double factor) {
+    if (m && m->m) {
+        m->m->zoom(factor);
+    }
+}
+
+void mapnik_map_pan(mapnik_map_t * m, int dx, int dy) {
+    if (m && m->m) {
+        // mapnik pans to the pixel that becomes the new center
+        m->m->pan(int(0.5 * m->m->width()) + dx, int(0.5 * m->m->height()) + dy);
+    }
+}
+
+void mapnik_map_get_current_extent(mapnik_map_t * m, double *x0, double *y0, double *x1, double *y1) {
+    if (m && m->m) {
+        mapnik::box2d<double> const& e = m->m->get_current_extent();
+        *x0 = e.minx();
+        *y0 = e.miny();
+        *x1 = e.maxx();
+        *y1 = e.maxy();
+    }
+}
+
+struct _mapnik_projection_t {
+    mapnik::projection * p;
+};
+
+mapnik_projection_t * mapnik_map_projection(mapnik_map_t *m) {
+    mapnik_map_reset_last_error(m);
+    if (m && m->m) {
+        try {
+            mapnik::projection * p = new mapnik::projection(m->m->srs());
+            mapnik_projection_t * proj = new mapnik_projection_t;
+            proj->p = p;
+            return proj;
+        } catch (std::exception const& ex) {
+            m->err = new std::string(ex.what());
+        }
+    }
+    return NULL;
+}
+
+mapnik_projection_t * mapnik_projection(const char *srs) {
+    try {
+        mapnik::projection * p = new mapnik::projection(srs);
+        mapnik_projection_t * proj = new mapnik_projection_t;
+        proj->p = p;
+        return proj;
+    } catch (std::exception const&) {
+        return NULL;
+    }
+}
+
+void mapnik_projection_free(mapnik_projection_t *p) {
+    if (p) {
+        if (p->p) {
+            delete p->p;
+        }
+        delete p;
+    }
+}
+
+mapnik_coord_t mapnik_projection_forward(mapnik_projection_t *p, mapnik_coord_t c) {
+    if (p && p->p) {
+        p->p->forward(c.x, c.y);
+    }
+    return c;
+}
+
+mapnik_coord_t mapnik_projection_inverse(mapnik_projection_t *p, mapnik_coord_t c) {
+    if (p && p->p) {
+        p->p->inverse(c.x, c.y);
+    }
+    return c;
+}
+
+int mapnik_projection_is_geographic(mapnik_projection_t *p) {
+    if (p && p->p) {
+        return p->p->is_geographic();
+    }
+    return 0;
+}
+
 struct _mapnik_image_t {
     mapnik_rgba_image *i;
     std::string * err;
@@ -288,12 +604,45 @@ const char *mapnik_image_last_error(mapnik_image_t *i) {
     return NULL;
 }
 
-mapnik_image_t * mapnik_map_render_to_image(mapnik_map_t * m, double scale, double scale_factor) {
+#ifndef MAPNIK_2
+// to_attributes converts parameters into the variables of expressions like [@name].
+static mapnik::attributes to_attributes(mapnik_parameters_t *vars) {
+    mapnik::attributes attrs;
+    if (!vars || !vars->p) {
+        return attrs;
+    }
+    mapnik::transcoder tr("utf-8");
+    for (mapnik::parameters::const_iterator it = vars->p->begin(); it != vars->p->end(); ++it) {
+        mapnik::value_holder const& v = it->second;
+        if (v.is<mapnik::value_integer>()) {
+            attrs[it->first] = v.get<mapnik::value_integer>();
+        } else if (v.is<mapnik::value_double>()) {
+            attrs[it->first] = v.get<mapnik::value_double>();
+        } else if (v.is<std::string>()) {
+            attrs[it->first] = tr.transcode(v.get<std::string>().c_str());
+        } else if (v.is<mapnik::value_bool>()) {
+            attrs[it->first] = v.get<mapnik::value_bool>();
+        } else {
+            attrs[it->first] = mapnik::value_null();
+        }
+    }
+    return attrs;
+}
+#endif
+
+mapnik_image_t * mapnik_map_render_to_image(mapnik_map_t * m, double scale, double scale_factor, mapnik_parameters_t *vars) {
     mapnik_map_reset_last_error(m);
     mapnik_rgba_image * im = new mapnik_rgba_image(m->m->width(), m->m->height());
     if (m && m->m) {
         try {
+#ifdef MAPNIK_2
+            if (vars && vars->p && !vars->p->empty()) {
+                throw std::runtime_error("render variables require Mapnik 3");
+            }
             mapnik::agg_renderer<mapnik_rgba_image> ren(*m->m, *im, scale_factor);
+#else
+            mapnik::agg_renderer<mapnik_rgba_image> ren(*m->m, *im, to_attributes(vars), scale_factor);
+#endif
             if (scale > 0.0) {
                 ren.apply(scale);
             } else {
@@ -311,12 +660,19 @@ mapnik_image_t * mapnik_map_render_to_image(mapnik_map_t * m, double scale, doub
     return i;
 }
 
-int mapnik_map_render_to_file(mapnik_map_t * m, const char* filepath, double scale, double scale_factor, const char *format) {
+int mapnik_map_render_to_file(mapnik_map_t * m, const char* filepath, double scale, double scale_factor, const char *format, mapnik_parameters_t *vars) {
     mapnik_map_reset_last_error(m);
     if (m && m->m) {
         try {
             mapnik_rgba_image buf(m->m->width(), m->m->height());
+#ifdef MAPNIK_2
+            if (vars && vars->p && !vars->p->empty()) {
+                throw std::runtime_error("render variables require Mapnik 3");
+            }
             mapnik::agg_renderer<mapnik_rgba_image> ren(*m->m, buf, scale_factor);
+#else
+            mapnik::agg_renderer<mapnik_rgba_image> ren(*m->m, buf, to_attributes(vars), scale_factor);
+#endif
             if (scale > 0.0) {
                 ren.apply(scale);
             } else {
@@ -386,10 +742,6 @@ mapnik_image_t * mapnik_image_from_raw(const uint8_t * raw, int width, int heigh
     return img;
 }
 
-struct _mapnik_parameters_t {
-    mapnik::parameters *p;
-};
-
 mapnik_parameters_t *mapnik_parameters() {
     mapnik_parameters_t *params = new mapnik_parameters_t;
     params->p = new mapnik::parameters;
@@ -411,18 +763,105 @@ void mapnik_parameters_set(mapnik_parameters_t *p, const char *key, const char *
     }
 }
 
+void mapnik_parameters_set_int(mapnik_parameters_t *p, const char *key, long long value) {
+    if (p && p->p) {
+        (*(p->p))[key] = static_cast<mapnik::value_integer>(value);
+    }
+}
+
+void mapnik_parameters_set_double(mapnik_parameters_t *p, const char *key, double value) {
+    if (p && p->p) {
+        (*(p->p))[key] = static_cast<mapnik::value_double>(value);
+    }
+}
+
+void mapnik_parameters_set_bool(mapnik_parameters_t *p, const char *key, int value) {
+    if (p && p->p) {
+#ifdef MAPNIK_2
+        // Mapnik 2 has no boolean parameters
+        (*(p->p))[key] = static_cast<mapnik::value_integer>(value != 0);
+#else
+        (*(p->p))[key] = static_cast<mapnik::value_bool>(value != 0);
+#endif
+    }
+}
+
+size_t mapnik_parameters_count(mapnik_parameters_t *p) {
+    if (p && p->p) {
+        return p->p->size();
+    }
+    return 0;
+}
+
+int mapnik_parameters_get(mapnik_parameters_t *p, size_t idx, const char **key, long long *i, double *d, const char **s) {
+    if (!p || !p->p || idx >= p->p->size()) {
+        return -1;
+    }
+    mapnik::parameters::const_iterator it = p->p->begin();
+    std::advance(it, idx);
+    *key = it->first.c_str();
+    mapnik::value_holder const& v = it->second;
+#ifdef MAPNIK_2
+    if (mapnik::value_integer const* vi = boost::get<mapnik::value_integer>(&v)) {
+        *i = *vi;
+        return MAPNIK_PARAMETER_INT;
+    } else if (mapnik::value_double const* vd = boost::get<mapnik::value_double>(&v)) {
+        *d = *vd;
+        return MAPNIK_PARAMETER_DOUBLE;
+    } else if (std::string const* vs = boost::get<std::string>(&v)) {
+        *s = vs->c_str();
+        return MAPNIK_PARAMETER_STRING;
+    }
+#else
+    if (v.is<mapnik::value_integer>()) {
+        *i = v.get<mapnik::value_integer>();
+        return MAPNIK_PARAMETER_INT;
+    } else if (v.is<mapnik::value_double>()) {
+        *d = v.get<mapnik::value_double>();
+        return MAPNIK_PARAMETER_DOUBLE;
+    } else if (v.is<std::string>()) {
+        *s = v.get<std::string>().c_str();
+        return MAPNIK_PARAMETER_STRING;
+    } else if (v.is<mapnik::value_bool>()) {
+        *i = v.get<mapnik::value_bool>();
+        return MAPNIK_PARAMETER_BOOL;
+    }
+#endif
+    return MAPNIK_PARAMETER_NULL;
+}
+
 struct _mapnik_datasource_t {
     mapnik::datasource_ptr ds;
+    std::string * err;
 };
 
+inline void mapnik_datasource_reset_last_error(mapnik_datasource_t *ds) {
+    if (ds && ds->err) {
+        delete ds->err;
+        ds->err = NULL;
+    }
+}
+
+const char *mapnik_datasource_last_error(mapnik_datasource_t *ds) {
+    if (ds && ds->err) {
+        return ds->err->c_str();
+    }
+    return NULL;
+}
+
 mapnik_datasource_t *mapnik_datasource(mapnik_parameters_t *p) {
     if (p && p->p) {
         mapnik_datasource_t *ds = new mapnik_datasource_t;
+        ds->err = NULL;
+        try {
 #if MAPNIK_VERSION >= 200200
-        ds->ds = mapnik::datasource_cache::instance().create(*(p->p));
+            ds->ds = mapnik::datasource_cache::instance().create(*(p->p));
 #else
-        ds->ds = mapnik::datasource_cache::instance()->create(*(p->p));
+            ds->ds = mapnik::datasource_cache::instance()->create(*(p->p));
 #endif
+        } catch (std::exception const& ex) {
+            ds->err = new std::string(ex.what());
+        }
         return ds;
     }
     return NULL;
@@ -430,10 +869,282 @@ mapnik_datasource_t *mapnik_datasource(mapnik_parameters_t *p) {
 
 void mapnik_datasource_free(mapnik_datasource_t *ds) {
     if (ds) {
+        if (ds->err) {
+            delete ds->err;
+        }
         delete ds;
     }
 }
 
+struct _mapnik_feature_t {
+    mapnik::feature_ptr f;
+    std::vector<std::string> keys;
+    std::string str;
+#ifndef MAPNIK_2
+    // reprojected geometry, overrides the geometry of f if set
+    std::unique_ptr<mapnik::geometry::geometry<double>> geom;
+#endif
+};
+
+mapnik_feature_t *mapnik_feature(long long id, const char *wkb, size_t len) {
+#ifdef MAPNIK_2
+    mapnik::context_ptr ctx = boost::make_shared<mapnik::context_type>();
+    mapnik::feature_ptr feature(mapnik::feature_factory::create(ctx, id));
+    if (!mapnik::geometry_utils::from_wkb(feature->paths(), wkb, len, mapnik::wkbGeneric)) {
+        return NULL;
+    }
+#else
+    mapnik::context_ptr ctx = std::make_shared<mapnik::context_type>();
+    mapnik::feature_ptr feature(mapnik::feature_factory::create(ctx, id));
+    mapnik::geometry::geometry<double> geom = mapnik::geometry_utils::from_wkb(wkb, len, mapnik::wkbGeneric);
+    if (geom.is<mapnik::geometry::geometry_empty>()) {
+        return NULL;
+    }
+    feature->set_geometry(std::move(geom));
+#endif
+    mapnik_feature_t *f = new mapnik_feature_t;
+    f->f = feature;
+    return f;
+}
+
+void mapnik_feature_free(mapnik_feature_t *f) {
+    if (f) {
+        delete f;
+    }
+}
+
+void mapnik_feature_put_null(mapnik_feature_t *f, const char *key) {
+    if (f && f->f) {
+        f->f->put_new(key, mapnik::value_null());
+    }
+}
+
+void mapnik_feature_put_string(mapnik_feature_t *f, const char *key, const char *value) {
+    if (f && f->f) {
+        mapnik::transcoder tr("utf-8");
+        f->f->put_new(key, tr.transcode(value));
+    }
+}
+
+void mapnik_feature_put_int(mapnik_feature_t *f, const char *key, long long value) {
+    if (f && f->f) {
+        f->f->put_new(key, static_cast<mapnik::value_integer>(value));
+    }
+}
+
+void mapnik_feature_put_double(mapnik_feature_t *f, const char *key, double value) {
+    if (f && f->f) {
+        f->f->put_new(key, value);
+    }
+}
+
+void mapnik_feature_put_bool(mapnik_feature_t *f, const char *key, int value) {
+    if (f && f->f) {
+        f->f->put_new(key, value != 0);
+    }
+}
+
+mapnik_datasource_t *mapnik_memory_datasource() {
+    mapnik_datasource_t *ds = new mapnik_datasource_t;
+    ds->err = NULL;
+#ifdef MAPNIK_2
+    ds->ds = boost::make_shared<mapnik::memory_datasource>();
+#else
+    mapnik::parameters params;
+    ds->ds = std::make_shared<mapnik::memory_datasource>(params);
+#endif
+    return ds;
+}
+
+void mapnik_memory_datasource_push(mapnik_datasource_t *ds, mapnik_feature_t *f) {
+    if (ds && ds->ds && f && f->f) {
+#ifdef MAPNIK_2
+        boost::static_pointer_cast<mapnik::memory_datasource>(ds->ds)->push(f->f);
+#else
+        std::static_pointer_cast<mapnik::memory_datasource>(ds->ds)->push(f->f);
+#endif
+    }
+}
+
+struct _mapnik_featureset_t {
+    mapnik::featureset_ptr fs;
+    std::string * err;
+#ifndef MAPNIK_2
+    mapnik::expression_ptr filter;
+    std::unique_ptr<mapnik::projection> source;
+    std::unique_ptr<mapnik::projection> dest;
+    std::unique_ptr<mapnik::proj_transform> tr;
+#endif
+};
+
+mapnik_featureset_t *mapnik_datasource_features(mapnik_datasource_t *ds, mapnik_bbox_t *b) {
+    mapnik_datasource_reset_last_error(ds);
+    if (!ds || !ds->ds || !b) {
+        return NULL;
+    }
+#ifdef MAPNIK_2
+    ds->err = new std::string("feature queries require Mapnik 3");
+    return NULL;
+#else
+    try {
+        mapnik::query q(b->b);
+        for (auto const& attr : ds->ds->get_descriptor().get_descriptors()) {
+            q.add_property_name(attr.get_name());
+        }
+        mapnik_featureset_t *fs = new mapnik_featureset_t;
+        fs->fs = ds->ds->features(q);
+        fs->err = NULL;
+        return fs;
+    } catch (std::exception const& ex) {
+        ds->err = new std::string(ex.what());
+        return NULL;
+    }
+#endif
+}
+
+mapnik_feature_t *mapnik_featureset_next(mapnik_featureset_t *fs) {
+    if (!fs || !fs->fs) {
+        return NULL;
+    }
+    if (fs->err) {
+        delete fs->err;
+        fs->err = NULL;
+    }
+    try {
+        mapnik::feature_ptr feature = fs->fs->next();
+#ifndef MAPNIK_2
+        mapnik::attributes vars;
+        while (feature && fs->filter) {
+            mapnik::value_type result = mapnik::util::apply_visitor(
+                mapnik::evaluate<mapnik::feature_impl, mapnik::value_type, mapnik::attributes>(*feature, vars),
+                *fs->filter);
+            if (result.to_bool()) {
+                break;
+            }
+            feature = fs->fs->next();
+        }
+#endif
+        if (!feature) {
+            return NULL;
+        }
+        mapnik_feature_t *f = new mapnik_feature_t;
+        f->f = feature;
+#ifndef MAPNIK_2
+        if (fs->tr) {
+            unsigned int n_err = 0;
+            f->geom.reset(new mapnik::geometry::geometry<double>(
+                mapnik::geometry::reproject_copy(feature->get_geometry(), *fs->tr, n_err)));
+        }
+#endif
+        return f;
+    } catch (std::exception const& ex) {
+        fs->err = new std::string(ex.what());
+        return NULL;
+    }
+}
+
+const char *mapnik_featureset_last_error(mapnik_featureset_t *fs) {
+    if (fs && fs->err) {
+        return fs->err->c_str();
+    }
+    return NULL;
+}
+
+void mapnik_featureset_free(mapnik_featureset_t *fs) {
+    if (fs) {
+        if (fs->err) {
+            delete fs->err;
+        }
+        delete fs;
+    }
+}
+
+long long mapnik_feature_id(mapnik_feature_t *f) {
+    if (f && f->f) {
+        return f->f->id();
+    }
+    return 0;
+}
+
+char *mapnik_feature_geometry_wkb(mapnik_feature_t *f, size_t *len) {
+    *len = 0;
+#ifndef MAPNIK_2
+    if (f && f->f) {
+        mapnik::geometry::geometry<double> const& geom = f->geom ? *f->geom : f->f->get_geometry();
+        mapnik::util::wkb_buffer_ptr wkb = mapnik::util::to_wkb(geom, mapnik::wkbNDR);
+        if (wkb) {
+            *len = wkb->size();
+            char *buf = new char[*len];
+            memcpy(buf, wkb->buffer(), *len);
+            return buf;
+        }
+    }
+#endif
+    return NULL;
+}
+
+void mapnik_wkb_free(char *wkb) {
+    if (wkb) {
+        delete[] wkb;
+    }
+}
+
+int mapnik_feature_attribute_count(mapnik_feature_t *f) {
+#ifndef MAPNIK_2
+    if (f && f->f) {
+        if (f->keys.empty()) {
+            for (auto const& kv : *f->f->context()) {
+                f->keys.push_back(kv.first);
+            }
+        }
+        return f->keys.size();
+    }
+#endif
+    return 0;
+}
+
+const char *mapnik_feature_attribute_name(mapnik_feature_t *f, int idx) {
+    if (f && idx >= 0 && idx < int(f->keys.size())) {
+        return f->keys[idx].c_str();
+    }
+    return NULL;
+}
+
+int mapnik_feature_attribute_type(mapnik_feature_t *f, int idx) {
+#ifndef MAPNIK_2
+    if (f && f->f && idx >= 0 && idx < int(f->keys.size())) {
+        mapnik::value const& v = f->f->get(f->keys[idx]);
+        if (v.is<mapnik::value_bool>()) {
+            return MAPNIK_VALUE_BOOL;
+        } else if (v.is<mapnik::value_integer>()) {
+            return MAPNIK_VALUE_INT;
+        } else if (v.is<mapnik::value_double>()) {
+            return MAPNIK_VALUE_DOUBLE;
+        } else if (v.is<mapnik::value_unicode_string>()) {
+            return MAPNIK_VALUE_STRING;
+        }
+    }
+#endif
+    return MAPNIK_VALUE_NULL;
+}
+
+long long mapnik_feature_attribute_int(mapnik_feature_t *f, int idx) {
+    return f->f->get(f->keys[idx]).to_int();
+}
+
+double mapnik_feature_attribute_double(mapnik_feature_t *f, int idx) {
+    return f->f->get(f->keys[idx]).to_double();
+}
+
+int mapnik_feature_attribute_bool(mapnik_feature_t *f, int idx) {
+    return f->f->get(f->keys[idx]).to_bool();
+}
+
+const char *mapnik_feature_attribute_string(mapnik_feature_t *f, int idx) {
+    f->str = f->f->get(f->keys[idx]).to_string();
+    return f->str.c_str();
+}
+
 struct _mapnik_layer_t {
     mapnik::layer *l;
 };
@@ -475,6 +1186,22 @@ void mapnik_map_add_layer(mapnik_map_t *m, mapnik_layer_t *l) {
     }
 }
 
+void mapnik_map_remove_layer(mapnik_map_t *m, size_t idx) {
+    if (m && m->m && idx < m->m->layer_count()) {
+#if MAPNIK_VERSION >= 300000
+        m->m->remove_layer(idx);
+#else
+        m->m->removeLayer(idx);
+#endif
+    }
+}
+
+void mapnik_map_remove_style(mapnik_map_t *m, const char *name) {
+    if (m && m->m) {
+        m->m->remove_style(name);
+    }
+}
+
 int mapnik_map_layer_count(mapnik_map_t * m) {
     if (m && m->m) {
         return m->m->layer_count();
@@ -517,6 +1244,57 @@ void mapnik_map_layer_set_active(mapnik_map_t * m, size_t idx, int active) {
     }
 }
 
+mapnik_featureset_t *mapnik_map_layer_features(mapnik_map_t *m, size_t idx, mapnik_bbox_t *b, const char *filter, const char *srs) {
+    mapnik_map_reset_last_error(m);
+    if (!m || !m->m || idx >= m->m->layer_count()) {
+        return NULL;
+    }
+#ifdef MAPNIK_2
+    m->err = new std::string("feature queries require Mapnik 3");
+    return NULL;
+#else
+    try {
+        mapnik::layer const& layer = m->m->get_layer(idx);
+        mapnik::datasource_ptr ds = layer.datasource();
+        if (!ds) {
+            m->err = new std::string("layer " + layer.name() + " has no datasource");
+            return NULL;
+        }
+
+        mapnik::box2d<double> box = ds->envelope();
+        if (b) {
+            // the bounding box is in the projection of the map
+            mapnik::projection map_proj(m->m->srs());
+            mapnik::projection layer_proj(layer.srs());
+            mapnik::proj_transform tr(layer_proj, map_proj);
+            box = b->b;
+            tr.backward(box, 20); // sample 20 points per side of the envelope
+        }
+        mapnik::query q(box);
+        for (auto const& attr : ds->get_descriptor().get_descriptors()) {
+            q.add_property_name(attr.get_name());
+        }
+
+        std::unique_ptr<mapnik_featureset_t> fs(new mapnik_featureset_t);
+        fs->err = NULL;
+        if (filter && *filter) {
+            fs->filter = mapnik::parse_expression(filter);
+        }
+        std::string dest = (srs && *srs) ? srs : m->m->srs();
+        if (dest != layer.srs()) {
+            fs->source.reset(new mapnik::projection(layer.srs()));
+            fs->dest.reset(new mapnik::projection(dest));
+            fs->tr.reset(new mapnik::proj_transform(*fs->source, *fs->dest));
+        }
+        fs->fs = ds->features(q);
+        return fs.release();
+    } catch (std::exception const& ex) {
+        m->err = new std::string(ex.what());
+        return NULL;
+    }
+#endif
+}
+
 int mapnik_map_background(mapnik_map_t * m, uint8_t *r, uint8_t *g, uint8_t *b, uint8_t *a) {
     if (m && m->m) {
         boost::optional<mapnik::color> const &bg = m->m->background();
@@ -539,6 +1317,250 @@ void mapnik_map_set_background(mapnik_map_t * m, uint8_t r, uint8_t g, uint8_t b
     }
 }
 
+#ifndef MAPNIK_2
+static void collect_faces(mapnik::font_set const& fontset, std::set<std::string> & faces) {
+    for (auto const& face : fontset.get_face_names()) {
+        faces.insert(face);
+    }
+}
+
+// collect_faces adds the faces of the nested Format, Layout and list nodes of a text.
+static void collect_faces(mapnik::formatting::node_ptr const& node, std::set<std::string> & faces) {
+    if (!node) {
+        return;
+    }
+    if (auto format = dynamic_cast<mapnik::formatting::format_node const*>(node.get())) {
+        if (format->face_name) {
+            faces.insert(*format->face_name);
+        }
+        if (format->fontset) {
+            collect_faces(*format->fontset, faces);
+        }
+        collect_faces(format->get_child(), faces);
+    } else if (auto layout = dynamic_cast<mapnik::formatting::layout_node const*>(node.get())) {
+        collect_faces(layout->get_child(), faces);
+    } else if (auto list = dynamic_cast<mapnik::formatting::list_node const*>(node.get())) {
+        for (auto const& child : list->get_children()) {
+            collect_faces(child, faces);
+        }
+    }
+}
+
+static void collect_faces(mapnik::text_symbolizer_properties const& props, std::set<std::string> & faces) {
+    mapnik::format_properties const& format = props.format_defaults;
+    if (!format.face_name.empty()) {
+        faces.insert(format.face_name);
+    }
+    if (format.fontset) {
+        collect_faces(*format.fontset, faces);
+    }
+    collect_faces(props.format_tree(), faces);
+}
+#endif
+
+mapnik_strings_t * mapnik_map_missing_fonts(mapnik_map_t * m) {
+    mapnik_map_reset_last_error(m);
+    if (!m || !m->m) {
+        return NULL;
+    }
+#ifdef MAPNIK_2
+    m->err = new std::string("font inspection requires Mapnik 3");
+    return NULL;
+#else
+    std::set<std::string> faces;
+    for (auto const& fontset : m->m->fontsets()) {
+        for (auto const& face : fontset.second.get_face_names()) {
+            faces.insert(face);
+        }
+    }
+    for (auto const& style : m->m->styles()) {
+        for (auto const& rule : style.second.get_rules()) {
+            for (auto const& sym : rule.get_symbolizers()) {
+                mapnik::text_placements_ptr placements;
+                if (sym.is<mapnik::text_symbolizer>()) {
+                    placements = mapnik::get<mapnik::text_placements_ptr>(sym.get<mapnik::text_symbolizer>(), mapnik::keys::text_placements_);
+                } else if (sym.is<mapnik::shield_symbolizer>()) {
+                    placements = mapnik::get<mapnik::text_placements_ptr>(sym.get<mapnik::shield_symbolizer>(), mapnik::keys::text_placements_);
+                }
+                if (!placements) {
+                    continue;
+                }
+                collect_faces(placements->defaults, faces);
+                // the alternatives of a placement list
+                if (auto list = dynamic_cast<mapnik::text_placements_list const*>(placements.get())) {
+                    for (unsigned i = 0; i < list->size(); ++i) {
+                        collect_faces(const_cast<mapnik::text_placements_list*>(list)->get(i), faces);
+                    }
+                }
+            }
+        }
+    }
+
+    std::vector<std::string> registered = mapnik::freetype_engine::face_names();
+    std::set<std::string> known(registered.begin(), registered.end());
+    for (auto const& kv : m->m->get_font_file_mapping()) {
+        known.insert(kv.first);
+    }
+    mapnik_strings_t *s = new mapnik_strings_t;
+    for (auto const& face : faces) {
+        if (known.find(face) == known.end()) {
+            s->v.push_back(face);
+        }
+    }
+    return s;
+#endif
+}
+
+int mapnik_map_set_font_directory(mapnik_map_t * m, const char *path) {
+    mapnik_map_reset_last_error(m);
+    if (!m || !m->m) {
+        return -1;
+    }
+    try {
+#ifdef MAPNIK_2
+        // Mapnik 2 has no per-map fonts
+        if (!mapnik::freetype_engine::register_fonts(path, false)) {
+#else
+        if (!m->m->register_fonts(path, false)) {
+#endif
+            m->err = new std::string(std::string("no fonts found in ") + path);
+            return -1;
+        }
+        m->m->set_font_directory(path);
+    } catch (std::exception const& ex) {
+        m->err = new std::string(ex.what());
+        return -1;
+    }
+    return 0;
+}
+
+const char * mapnik_map_get_font_directory(mapnik_map_t * m) {
+    if (m && m->m && m->m->font_directory()) {
+        return m->m->font_directory()->c_str();
+    }
+    return NULL;
+}
+
+int mapnik_map_insert_fontset(mapnik_map_t * m, const char *name, const char **faces, size_t n) {
+    mapnik_map_reset_last_error(m);
+    if (!m || !m->m) {
+        return -1;
+    }
+    mapnik::font_set fontset(name);
+    for (size_t i = 0; i < n; i++) {
+        fontset.add_face_name(faces[i]);
+    }
+    if (!m->m->insert_fontset(name, fontset)) {
+        m->err = new std::string(std::string("fontset already exists: ") + name);
+        return -1;
+    }
+    return 0;
+}
+
+mapnik_strings_t * mapnik_map_fontset_names(mapnik_map_t * m) {
+    mapnik_strings_t *s = new mapnik_strings_t;
+    if (m && m->m) {
+        std::map<std::string, mapnik::font_set> const& fontsets = m->m->fontsets();
+        for (std::map<std::string, mapnik::font_set>::const_iterator it = fontsets.begin(); it != fontsets.end(); ++it) {
+            s->v.push_back(it->first);
+        }
+    }
+    return s;
+}
+
+mapnik_strings_t * mapnik_map_fontset_faces(mapnik_map_t * m, const char *name) {
+    if (!m || !m->m) {
+        return NULL;
+    }
+    std::map<std::string, mapnik::font_set> const& fontsets = m->m->fontsets();
+    std::map<std::string, mapnik::font_set>::const_iterator it = fontsets.find(name);
+    if (it == fontsets.end()) {
+        return NULL;
+    }
+    mapnik_strings_t *s = new mapnik_strings_t;
+    s->v = it->second.get_face_names();
+    return s;
+}
+
+int mapnik_map_get_maximum_extent(mapnik_map_t * m, double *x0, double *y0, double *x1, double *y1) {
+    if (m && m->m && m->m->maximum_extent()) {
+        mapnik::box2d<double> const& e = *m->m->maximum_extent();
+        *x0 = e.minx();
+        *y0 = e.miny();
+        *x1 = e.maxx();
+        *y1 = e.maxy();
+        return 1;
+    }
+    return 0;
+}
+
+mapnik_parameters_t * mapnik_map_get_parameters(mapnik_map_t * m) {
+    if (m && m->m) {
+        mapnik_parameters_t *params = new mapnik_parameters_t;
+        params->p = new mapnik::parameters(m->m->get_extra_parameters());
+        return params;
+    }
+    return NULL;
+}
+
+void mapnik_map_set_parameters(mapnik_map_t * m, mapnik_parameters_t *p) {
+    if (m && m->m && p && p->p) {
+        m->m->set_extra_parameters(*(p->p));
+    }
+}
+
+const char * mapnik_map_layer_srs(mapnik_map_t * m, size_t idx) {
+    if (m && m->m) {
+#ifdef MAPNIK_2
+        mapnik::layer const& layer = m->m->getLayer(idx);
+#else
+        mapnik::layer const& layer = m->m->get_layer(idx);
+#endif
+        return layer.srs().c_str();
+    }
+    return NULL;
+}
+
+void mapnik_map_layer_scale_denominators(mapnik_map_t * m, size_t idx, double *min, double *max) {
+    if (m && m->m) {
+#ifdef MAPNIK_2
+        mapnik::layer const& layer = m->m->getLayer(idx);
+        *min = layer.min_zoom();
+        *max = layer.max_zoom();
+#else
+        mapnik::layer const& layer = m->m->get_layer(idx);
+        *min = layer.minimum_scale_denominator();
+        *max = layer.maximum_scale_denominator();
+#endif
+    }
+}
+
+int mapnik_map_layer_envelope(mapnik_map_t * m, size_t idx, double *x0, double *y0, double *x1, double *y1) {
+    mapnik_map_reset_last_error(m);
+    if (m && m->m) {
+        try {
+#ifdef MAPNIK_2
+            mapnik::layer const& layer = m->m->getLayer(idx);
+#else
+            mapnik::layer const& layer = m->m->get_layer(idx);
+#endif
+            mapnik::box2d<double> e = layer.envelope();
+            if (!e.valid()) {
+                return 0;
+            }
+            *x0 = e.minx();
+            *y0 = e.miny();
+            *x1 = e.maxx();
+            *y1 = e.maxy();
+            return 1;
+        } catch (std::exception const& ex) {
+            m->err = new std::string(ex.what());
+            return -1;
+        }
+    }
+    return 0;
+}
+
 void mapnik_map_set_maximum_extent(mapnik_map_t * m, double x0, double y0, double x1, double y1) {
     if (m && m->m) {
         mapnik::box2d<double> extent(x0, y0, x1, y1);
@@ -22,21 +22,66 @@ extern const int mapnik_version_patch;
 MAPNIKCAPICALL int mapnik_register_datasources(const char* path);
 MAPNIKCAPICALL int mapnik_register_fonts(const char* path);
 
-const int MAPNIK_NONE = 0;
-const int MAPNIK_DEBUG = 1;
-const int MAPNIK_WARN = 2;
-const int MAPNIK_ERROR = 3;
+#define MAPNIK_NONE 0
+#define MAPNIK_DEBUG 1
+#define MAPNIK_WARN 2
+#define MAPNIK_ERROR 3
 
 MAPNIKCAPICALL void mapnik_logging_set_severity(int);
+MAPNIKCAPICALL void mapnik_logging_set_object_severity(const char *name, int);
+
+// Callback for each line of log output. NULL restores the output to stderr.
+typedef void (*mapnik_log_callback_t)(const char *line);
+MAPNIKCAPICALL void mapnik_logging_set_callback(mapnik_log_callback_t cb);
 
 MAPNIKCAPICALL const char * mapnik_register_last_error();
 
+// List of strings
+typedef struct _mapnik_strings_t mapnik_strings_t;
+MAPNIKCAPICALL size_t mapnik_strings_count(mapnik_strings_t *s);
+MAPNIKCAPICALL const char * mapnik_strings_get(mapnik_strings_t *s, size_t idx);
+MAPNIKCAPICALL void mapnik_strings_free(mapnik_strings_t *s);
+
+// Plugins and features
+MAPNIKCAPICALL mapnik_strings_t * mapnik_plugin_names();
+MAPNIKCAPICALL mapnik_strings_t * mapnik_plugin_directories();
+
+#define MAPNIK_FEATURE_PNG 1
+#define MAPNIK_FEATURE_JPEG 2
+#define MAPNIK_FEATURE_WEBP 4
+#define MAPNIK_FEATURE_TIFF 8
+#define MAPNIK_FEATURE_CAIRO 16
+#define MAPNIK_FEATURE_GRID 32
+#define MAPNIK_FEATURE_PROJ 64
+
+MAPNIKCAPICALL int mapnik_features();
+
+// Fonts
+MAPNIKCAPICALL mapnik_strings_t * mapnik_font_faces();
+MAPNIKCAPICALL const char * mapnik_font_file(const char *face);
+MAPNIKCAPICALL mapnik_strings_t * mapnik_register_font_faces(const char *path, int recursive);
+
 // BBOX
 typedef struct _mapnik_bbox_t mapnik_bbox_t;
 MAPNIKCAPICALL mapnik_bbox_t * mapnik_bbox(double minx, double miny, double maxx, double maxy);
 MAPNIKCAPICALL void mapnik_bbox_free(mapnik_bbox_t * b);
 
 
+// Projection
+typedef struct _mapnik_projection_t mapnik_projection_t;
+
+typedef struct _mapnik_coord_t {
+    double x;
+    double y;
+} mapnik_coord_t;
+
+MAPNIKCAPICALL mapnik_projection_t * mapnik_projection(const char *srs);
+MAPNIKCAPICALL void mapnik_projection_free(mapnik_projection_t *p);
+MAPNIKCAPICALL mapnik_coord_t mapnik_projection_forward(mapnik_projection_t *p, mapnik_coord_t c);
+MAPNIKCAPICALL mapnik_coord_t mapnik_projection_inverse(mapnik_projection_t *p, mapnik_coord_t c);
+MAPNIKCAPICALL int mapnik_projection_is_geographic(mapnik_projection_t *p);
+
+
 // Image
 MAPNIKCAPICALL typedef struct _mapnik_image_t mapnik_image_t;
 MAPNIKCAPICALL void mapnik_image_free(mapnik_image_t * i);
@@ -63,6 +108,19 @@ MAPNIKCAPICALL mapnik_parameters_t *mapnik_parameters();
 MAPNIKCAPICALL void mapnik_parameters_free(mapnik_parameters_t *p);
 
 MAPNIKCAPICALL void mapnik_parameters_set(mapnik_parameters_t *p, const char *key, const char *value);
+MAPNIKCAPICALL void mapnik_parameters_set_int(mapnik_parameters_t *p, const char *key, long long value);
+MAPNIKCAPICALL void mapnik_parameters_set_double(mapnik_parameters_t *p, const char *key, double value);
+MAPNIKCAPICALL void mapnik_parameters_set_bool(mapnik_parameters_t *p, const char *key, int value);
+
+#define MAPNIK_PARAMETER_NULL 0
+#define MAPNIK_PARAMETER_INT 1
+#define MAPNIK_PARAMETER_DOUBLE 2
+#define MAPNIK_PARAMETER_STRING 3
+#define MAPNIK_PARAMETER_BOOL 4
+
+MAPNIKCAPICALL size_t mapnik_parameters_count(mapnik_parameters_t *p);
+// Returns the type of the parameter at idx, or -1 if idx is out of range.
+MAPNIKCAPICALL int mapnik_parameters_get(mapnik_parameters_t *p, size_t idx, const char **key, long long *i, double *d, const char **s);
 
 
 // Datasource
@@ -72,6 +130,53 @@ MAPNIKCAPICALL mapnik_datasource_t *mapnik_datasource(mapnik_parameters_t *p);
 
 MAPNIKCAPICALL void mapnik_datasource_free(mapnik_datasource_t *ds);
 
+MAPNIKCAPICALL const char * mapnik_datasource_last_error(mapnik_datasource_t *ds);
+
+
+// Feature
+typedef struct _mapnik_feature_t mapnik_feature_t;
+
+MAPNIKCAPICALL mapnik_feature_t *mapnik_feature(long long id, const char *wkb, size_t len);
+MAPNIKCAPICALL void mapnik_feature_free(mapnik_feature_t *f);
+
+MAPNIKCAPICALL void mapnik_feature_put_null(mapnik_feature_t *f, const char *key);
+MAPNIKCAPICALL void mapnik_feature_put_string(mapnik_feature_t *f, const char *key, const char *value);
+MAPNIKCAPICALL void mapnik_feature_put_int(mapnik_feature_t *f, const char *key, long long value);
+MAPNIKCAPICALL void mapnik_feature_put_double(mapnik_feature_t *f, const char *key, double value);
+MAPNIKCAPICALL void mapnik_feature_put_bool(mapnik_feature_t *f, const char *key, int value);
+
+MAPNIKCAPICALL long long mapnik_feature_id(mapnik_feature_t *f);
+MAPNIKCAPICALL char * mapnik_feature_geometry_wkb(mapnik_feature_t *f, size_t *len);
+MAPNIKCAPICALL void mapnik_wkb_free(char *wkb);
+
+#define MAPNIK_VALUE_NULL 0
+#define MAPNIK_VALUE_BOOL 1
+#define MAPNIK_VALUE_INT 2
+#define MAPNIK_VALUE_DOUBLE 3
+#define MAPNIK_VALUE_STRING 4
+
+MAPNIKCAPICALL int mapnik_feature_attribute_count(mapnik_feature_t *f);
+MAPNIKCAPICALL const char * mapnik_feature_attribute_name(mapnik_feature_t *f, int idx);
+MAPNIKCAPICALL int mapnik_feature_attribute_type(mapnik_feature_t *f, int idx);
+MAPNIKCAPICALL long long mapnik_feature_attribute_int(mapnik_feature_t *f, int idx);
+MAPNIKCAPICALL double mapnik_feature_attribute_double(mapnik_feature_t *f, int idx);
+MAPNIKCAPICALL int mapnik_feature_attribute_bool(mapnik_feature_t *f, int idx);
+MAPNIKCAPICALL const char * mapnik_feature_attribute_string(mapnik_feature_t *f, int idx);
+
+
+// Featureset
+typedef struct _mapnik_featureset_t mapnik_featureset_t;
+
+MAPNIKCAPICALL mapnik_featureset_t *mapnik_datasource_features(mapnik_datasource_t *ds, mapnik_bbox_t *b);
+MAPNIKCAPICALL mapnik_feature_t *mapnik_featureset_next(mapnik_featureset_t *fs);
+MAPNIKCAPICALL const char * mapnik_featureset_last_error(mapnik_featureset_t *fs);
+MAPNIKCAPICALL void mapnik_featureset_free(mapnik_featureset_t *fs);
+
+
+// Memory datasource
+MAPNIKCAPICALL mapnik_datasource_t *mapnik_memory_datasource();
+MAPNIKCAPICALL void mapnik_memory_datasource_push(mapnik_datasource_t *ds, mapnik_feature_t *f);
+
 
 // Layer
 typedef struct _mapnik_layer_t mapnik_layer_t;
@@ -92,8 +197,8 @@ MAPNIKCAPICALL void mapnik_map_free(mapnik_map_t * m);
 
 MAPNIKCAPICALL const char * mapnik_map_last_error(mapnik_map_t * m);
 
-MAPNIKCAPICALL int mapnik_map_load(mapnik_map_t * m, const char* stylesheet);
-MAPNIKCAPICALL int mapnik_map_load_string(mapnik_map_t *m, const char* s, const char* base_path);
+MAPNIKCAPICALL int mapnik_map_load(mapnik_map_t * m, const char* stylesheet, int strict);
+MAPNIKCAPICALL int mapnik_map_load_string(mapnik_map_t *m, const char* s, const char* base_path, int strict);
 
 MAPNIKCAPICALL const char * mapnik_map_get_srs(mapnik_map_t * m);
 MAPNIKCAPICALL int mapnik_map_set_srs(mapnik_map_t * m, const char* srs);
@@ -109,19 +214,41 @@ MAPNIKCAPICALL void mapnik_map_set_background(mapnik_map_t * m, uint8_t r, uint8
 
 MAPNIKCAPICALL int mapnik_map_zoom_all(mapnik_map_t * m);
 MAPNIKCAPICALL void mapnik_map_zoom_to_box(mapnik_map_t * m, mapnik_bbox_t * b);
+MAPNIKCAPICALL void mapnik_map_zoom(mapnik_map_t * m, double factor);
+MAPNIKCAPICALL void mapnik_map_pan(mapnik_map_t * m, int dx, int dy);
+MAPNIKCAPICALL void mapnik_map_get_current_extent(mapnik_map_t * m, double *x0, double *y0, double *x1, double *y1);
+
+MAPNIKCAPICALL mapnik_projection_t * mapnik_map_projection(mapnik_map_t *m);
 
 MAPNIKCAPICALL void mapnik_map_set_maximum_extent(mapnik_map_t * m, double x0, double y0, double x1, double y1);
 MAPNIKCAPICALL void mapnik_map_reset_maximum_extent(mapnik_map_t * m);
+MAPNIKCAPICALL mapnik_strings_t * mapnik_map_missing_fonts(mapnik_map_t * m);
+MAPNIKCAPICALL int mapnik_map_set_font_directory(mapnik_map_t * m, const char *path);
+MAPNIKCAPICALL const char * mapnik_map_get_font_directory(mapnik_map_t * m);
+MAPNIKCAPICALL int mapnik_map_insert_fontset(mapnik_map_t * m, const char *name, const char **faces, size_t n);
+MAPNIKCAPICALL mapnik_strings_t * mapnik_map_fontset_names(mapnik_map_t * m);
+MAPNIKCAPICALL mapnik_strings_t * mapnik_map_fontset_faces(mapnik_map_t * m, const char *name);
+
+MAPNIKCAPICALL int mapnik_map_get_maximum_extent(mapnik_map_t * m, double *x0, double *y0, double *x1, double *y1);
+
+MAPNIKCAPICALL mapnik_parameters_t * mapnik_map_get_parameters(mapnik_map_t * m);
+MAPNIKCAPICALL void mapnik_map_set_parameters(mapnik_map_t * m, mapnik_parameters_t *p);
 
-MAPNIKCAPICALL int mapnik_map_render_to_file(mapnik_map_t * m, const char* filepath, double scale, double scale_factor, const char *format);
-MAPNIKCAPICALL mapnik_image_t * mapnik_map_render_to_image(mapnik_map_t * m, double scale, double scale_factor);
+MAPNIKCAPICALL int mapnik_map_render_to_file(mapnik_map_t * m, const char* filepath, double scale, double scale_factor, const char *format, mapnik_parameters_t *vars);
+MAPNIKCAPICALL mapnik_image_t * mapnik_map_render_to_image(mapnik_map_t * m, double scale, double scale_factor, mapnik_parameters_t *vars);
 
 MAPNIKCAPICALL void mapnik_map_add_layer(mapnik_map_t *m, mapnik_layer_t *l);
+MAPNIKCAPICALL void mapnik_map_remove_layer(mapnik_map_t *m, size_t idx);
+MAPNIKCAPICALL void mapnik_map_remove_style(mapnik_map_t *m, const char *name);
 
 MAPNIKCAPICALL int mapnik_map_layer_count(mapnik_map_t * m);
 MAPNIKCAPICALL const char * mapnik_map_layer_name(mapnik_map_t * m, size_t idx);
 MAPNIKCAPICALL int mapnik_map_layer_is_active(mapnik_map_t * m, size_t idx);
 MAPNIKCAPICALL void mapnik_map_layer_set_active(mapnik_map_t * m, size_t idx, int active);
+MAPNIKCAPICALL mapnik_featureset_t * mapnik_map_layer_features(mapnik_map_t *m, size_t idx, mapnik_bbox_t *b, const char *filter, const char *srs);
+MAPNIKCAPICALL const char * mapnik_map_layer_srs(mapnik_map_t * m, size_t idx);
+MAPNIKCAPICALL void mapnik_map_layer_scale_denominators(mapnik_map_t * m, size_t idx, double *min, double *max);
+MAPNIKCAPICALL int mapnik_map_layer_envelope(mapnik_map_t * m, size_t idx, double *x0, double *y0, double *x1, double *y1);
 
 #ifdef __cplusplus
 }
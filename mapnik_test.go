@@ -2,6 +2,7 @@ package mapnik
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/color"
 	"image/png"
@@ -64,6 +65,15 @@ func TestDatasource(t *testing.T) {
 	if d.ds == nil {
 		t.Error("did not create new datasource")
 	}
+	if err := d.Err(); err != nil {
+		t.Error(err)
+	}
+
+	missing := NewDatasource(map[string]string{"file": "test/missing.geojson", "type": "geojson"})
+	if missing.Err() == nil {
+		t.Error("missing file did not return an error")
+	}
+	missing.Free()
 
 	d.Free()
 	if d.ds != nil {
@@ -71,6 +81,223 @@ func TestDatasource(t *testing.T) {
 	}
 }
 
+func TestMemoryDatasource(t *testing.T) {
+	d, err := NewMemoryDatasource([]Feature{
+		{
+			Geometry:   Polygon{{{4, 49}, {4, 54}, {12, 54}, {12, 49}, {4, 49}}},
+			Properties: map[string]interface{}{"name": "box", "rank": 1, "area": 40.0, "visible": true, "note": nil},
+		},
+		{Geometry: Point{8, 51}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Free()
+
+	m := New()
+	if err := m.LoadString(`<Map><Style name="mem"><Rule><Filter>[name] = 'box'</Filter><PolygonSymbolizer fill="red" /></Rule></Style></Map>`, ""); err != nil {
+		t.Fatal(err)
+	}
+	l := NewLayer("mem", m.SRS())
+	l.AddStyle("mem")
+	l.SetDatasource(d)
+	m.AddLayer(l)
+	l.Free()
+
+	m.ZoomTo(0, 45, 16, 57)
+	img, err := m.RenderImage(RenderOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := color.NRGBAModel.Convert(img.At(400, 300)).(color.NRGBA)
+	if !colorEqual(color.NRGBA{255, 0, 0, 255}, c, 2) {
+		t.Error("memory datasource not rendered", c)
+	}
+
+	if _, err := NewMemoryDatasource([]Feature{{Geometry: Point{0, 0}, Properties: map[string]interface{}{"x": []int{1}}}}); err == nil {
+		t.Error("unsupported property type did not return an error")
+	}
+	if _, err := NewMemoryDatasource([]Feature{{}}); err == nil {
+		t.Error("missing geometry did not return an error")
+	}
+}
+
+func TestDatasourceFeatures(t *testing.T) {
+	if Version.Major < 3 {
+		t.Skip("feature queries require Mapnik 3")
+	}
+	features := []Feature{
+		{
+			ID:         7,
+			Geometry:   Polygon{{{4, 49}, {4, 54}, {12, 54}, {12, 49}, {4, 49}}},
+			Properties: map[string]interface{}{"name": "box", "rank": 1, "area": 40.5, "visible": true},
+		},
+		{ID: 8, Geometry: MultiPoint{{8, 51}, {9, 52}}, Properties: map[string]interface{}{}},
+	}
+	d, err := NewMemoryDatasource(features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Free()
+
+	actual, err := d.Features(-180, -90, 180, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	features[0].Properties["rank"] = int64(1)
+	assertEqual(t, features, actual)
+
+	actual, err = d.Features(0, 0, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 0, len(actual))
+
+	d = NewDatasource(map[string]string{"file": "test/map.geojson", "type": "geojson"})
+	defer d.Free()
+	actual, err = d.Features(-180, -90, 180, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 1, len(actual))
+	assertEqual(t, Polygon{{{4, 49}, {4, 54}, {12, 54}, {12, 49}, {4, 49}}}, actual[0].Geometry)
+}
+
+func TestLayerFeatures(t *testing.T) {
+	if Version.Major < 3 {
+		t.Skip("feature queries require Mapnik 3")
+	}
+	m := New()
+	d, err := NewMemoryDatasource([]Feature{
+		{Geometry: Point{8, 51}, Properties: map[string]interface{}{"name": "a"}},
+		{Geometry: Point{9, 52}, Properties: map[string]interface{}{"name": "b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLayer("points", m.SRS())
+	l.SetDatasource(d)
+	m.AddLayer(l)
+
+	features, err := m.LayerFeatures("points", LayerQuery{Filter: "[name] = 'b'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 1, len(features))
+	assertEqual(t, Point{9, 52}, features[0].Geometry)
+
+	features, err = m.LayerFeatures("points", LayerQuery{BBox: &[4]float64{7, 50, 8.5, 51.5}, SRS: "+init=epsg:3857"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 1, len(features))
+	if p, ok := features[0].Geometry.(Point); !ok || math.Abs(p.X-890555.93) > 0.01 {
+		t.Error("unexpected reprojected geometry", features[0].Geometry)
+	}
+
+	if _, err := m.LayerFeatures("points", LayerQuery{Filter: "[name] = "}); err == nil {
+		t.Error("invalid filter did not return an error")
+	}
+	if _, err := m.LayerFeatures("unknown", LayerQuery{}); err == nil {
+		t.Error("unknown layer did not return an error")
+	}
+}
+
+func TestRenderVectorTile(t *testing.T) {
+	if Version.Major < 3 {
+		t.Skip("feature queries require Mapnik 3")
+	}
+	m := New()
+	if err := m.Load("test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	// layerE is only visible from zoom level 6
+	err := m.LoadString(fmt.Sprintf(`<Map>
+		<Layer name="layerE" srs="+init=epsg:4326" maximum-scale-denominator="%f">
+			<StyleName>styleA</StyleName>
+			<Datasource>
+				<Parameter name="file">map.geojson</Parameter>
+				<Parameter name="type">geojson</Parameter>
+			</Datasource>
+		</Layer>
+	</Map>`, ZoomScaleDenominator(6)*math.Sqrt2), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.RenderVectorTile(4, 8, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := DecodeVectorTile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// layerD is inactive, layerE is not visible at zoom level 4
+	assertEqual(t, 3, len(layers))
+	assertEqual(t, "layerA", layers[0].Name)
+	assertEqual(t, 1, len(layers[0].Features))
+	p, ok := layers[0].Features[0].Geometry.(Polygon)
+	if !ok || len(p) != 1 || len(p[0]) != 5 {
+		t.Fatal("unexpected geometry", layers[0].Features[0].Geometry)
+	}
+	for _, c := range p[0] {
+		if c.X < 0 || c.X > VectorTileExtent || c.Y < 0 || c.Y > VectorTileExtent {
+			t.Error("coordinate outside of tile", c)
+		}
+	}
+
+	x, y := LonLatToTile(8, 51, 7)
+	b, err = m.RenderVectorTile(7, x, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layers, err = DecodeVectorTile(b); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 4, len(layers))
+	assertEqual(t, "layerE", layers[3].Name)
+
+	// outside of the polygon
+	b, err = m.RenderVectorTile(4, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, 0, len(b))
+}
+
+func TestGeoJSONDatasource(t *testing.T) {
+	b, err := ioutil.ReadFile("test/map.geojson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := FromGeoJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Free()
+	if Version.Major >= 3 {
+		features, err := d.Features(-180, -90, 180, 90)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(features) != 1 {
+			t.Error("unexpected features", features)
+		}
+	}
+
+	d, err = NewGeoJSONDatasource(strings.NewReader(`{"type": "Feature", "properties": {}, "geometry": {"type": "Point", "coordinates": [8, 51]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Free()
+
+	for _, invalid := range []string{``, `{"type": "FeatureCollection", "features": [`, `[]`, `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Circle"}}]}`} {
+		if _, err := FromGeoJSON([]byte(invalid)); err == nil {
+			t.Errorf("invalid GeoJSON %q did not return an error", invalid)
+		}
+	}
+}
+
 func TestLayer(t *testing.T) {
 	l := NewLayer("test", "+init=epsg:4326")
 	if l.l == nil {
@@ -159,6 +386,105 @@ func TestAspectFixMode(t *testing.T) {
 
 }
 
+func TestNewProjection(t *testing.T) {
+	p, err := NewProjection(WebMercator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Free()
+	c := p.Forward(Coord{9, 53})
+	expected := LonLatToMercator(Coord{9, 53})
+	if math.Abs(c.X-expected.X) > 1e-6 || math.Abs(c.Y-expected.Y) > 1e-6 {
+		t.Error("unexpected coord", c, expected)
+	}
+	c = p.Inverse(c)
+	if math.Abs(c.X-9) > 1e-9 || math.Abs(c.Y-53) > 1e-9 {
+		t.Error("unexpected inverse coord", c)
+	}
+
+	if _, err := NewProjection("+proj=invalid"); err == nil {
+		t.Error("invalid projection did not return an error")
+	}
+}
+
+func TestParameters(t *testing.T) {
+	m := New()
+	defer m.Free()
+	err := m.LoadString(`<Map>
+		<Parameters>
+			<Parameter name="name">Test</Parameter>
+			<Parameter name="maxzoom" type="int">14</Parameter>
+			<Parameter name="ratio" type="float">0.5</Parameter>
+		</Parameters>
+	</Map>`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := m.Parameters()
+	if len(params) != 3 || params["name"] != "Test" || params["maxzoom"] != int64(14) || params["ratio"] != 0.5 {
+		t.Error("unexpected parameters", params)
+	}
+
+	for k, v := range map[string]interface{}{"name": "Other", "minzoom": 2, "scale": 1.5, "dark": true} {
+		if err := m.SetParameter(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	params = m.Parameters()
+	if len(params) != 6 || params["name"] != "Other" || params["minzoom"] != int64(2) || params["scale"] != 1.5 || params["dark"] != true {
+		t.Error("unexpected parameters", params)
+	}
+	if err := m.SetParameter("invalid", []string{}); err == nil {
+		t.Error("unsupported type did not return an error")
+	}
+}
+
+func TestZoomToCenter(t *testing.T) {
+	m := New()
+	if err := m.Load("test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ZoomToCenter(8, 51, 5e6); err != nil {
+		t.Fatal(err)
+	}
+	if s := m.ScaleDenominator(); math.Abs(s-5e6) > 1 {
+		t.Error("unexpected scale denominator", s)
+	}
+	minx, miny, maxx, maxy := m.CurrentExtent()
+	if math.Abs((minx+maxx)/2-8) > 1e-9 || math.Abs((miny+maxy)/2-51) > 1e-9 {
+		t.Error("unexpected center", minx, miny, maxx, maxy)
+	}
+}
+
+func TestZoomToZoomLevel(t *testing.T) {
+	m := New()
+	if err := m.Load("test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ZoomToZoomLevel(8, 51, 10); err != nil {
+		t.Fatal(err)
+	}
+	if s := m.ScaleDenominator(); math.Abs(s-zoomLevel0Scale/1024) > 1 {
+		t.Error("unexpected scale denominator", s)
+	}
+}
+
+func TestPanZoomBy(t *testing.T) {
+	m := New()
+	m.ZoomTo(0, 0, 80, 60)
+	m.Pan(100, -200)
+	minx, miny, maxx, maxy := m.CurrentExtent()
+	if minx != 10 || miny != 20 || maxx != 90 || maxy != 80 {
+		t.Error("unexpected extent after pan", minx, miny, maxx, maxy)
+	}
+
+	s := m.ScaleDenominator()
+	m.ZoomBy(2)
+	if math.Abs(m.ScaleDenominator()-2*s) > 1 {
+		t.Error("unexpected scale denominator after zoom", m.ScaleDenominator(), s)
+	}
+}
+
 func TestBackgroundColor(t *testing.T) {
 	m := New()
 	c := m.BackgroundColor()
@@ -181,6 +507,53 @@ func TestBackgroundColor(t *testing.T) {
 	}
 }
 
+func TestRenderVariables(t *testing.T) {
+	m := New()
+	defer m.Free()
+	err := m.LoadString(`<Map>
+		<Style name="theme">
+			<Rule>
+				<Filter>@theme = 'red'</Filter>
+				<PolygonSymbolizer fill="rgb(255, 0, 0)" />
+			</Rule>
+			<Rule>
+				<Filter>@theme = 'blue'</Filter>
+				<PolygonSymbolizer fill="rgb(0, 0, 255)" />
+			</Rule>
+		</Style>
+		<Layer name="polygon">
+			<StyleName>theme</StyleName>
+			<Datasource>
+				<Parameter name="file">map.geojson</Parameter>
+				<Parameter name="type">geojson</Parameter>
+			</Datasource>
+		</Layer>
+	</Map>`, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Resize(16, 16)
+	m.ZoomTo(5, 50, 11, 53)
+
+	for theme, expected := range map[string]color.NRGBA{
+		"red":  {255, 0, 0, 255},
+		"blue": {0, 0, 255, 255},
+		"none": {0, 0, 0, 0},
+	} {
+		img, err := m.RenderImage(RenderOpts{Variables: map[string]interface{}{"theme": theme}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := img.NRGBAAt(8, 8); !colorEqual(expected, c, 2) {
+			t.Errorf("theme %s: expected %v, got %v", theme, expected, c)
+		}
+	}
+
+	if _, err := m.RenderImage(RenderOpts{Variables: map[string]interface{}{"theme": []int{}}}); err == nil {
+		t.Error("unsupported variable type did not return an error")
+	}
+}
+
 func colorEqual(expected, actual color.NRGBA, delta int) bool {
 	if math.Abs(float64(expected.R-actual.R)) > float64(delta) ||
 		math.Abs(float64(expected.G-actual.G)) > float64(delta) ||
@@ -400,3 +773,39 @@ func BenchmarkEncodeGo(b *testing.B) {
 		}
 	}
 }
+
+func TestRenderTileImage(t *testing.T) {
+	m := New()
+	defer m.Free()
+	if err := m.Load("test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	background := color.NRGBA{70, 130, 180, 255}
+	// the polygon 4,49 - 12,54 at the pixels of web mercator tiles, not of the
+	// equirectangular projection of the map
+	tests := []struct {
+		z, x, y         int
+		inside, outside image.Point
+	}{
+		{0, 0, 0, image.Pt(133, 85), image.Pt(133, 26)},
+		{1, 1, 0, image.Pt(11, 170), image.Pt(11, 52)},
+	}
+	for _, tt := range tests {
+		img, err := m.RenderTileImage(tt.z, tt.x, tt.y, RenderOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := img.NRGBAAt(tt.inside.X, tt.inside.Y); c == background {
+			t.Errorf("%d/%d/%d: polygon missing at %v", tt.z, tt.x, tt.y, tt.inside)
+		}
+		if c := img.NRGBAAt(tt.outside.X, tt.outside.Y); c != background {
+			t.Errorf("%d/%d/%d: unexpected color %v at %v", tt.z, tt.x, tt.y, c, tt.outside)
+		}
+	}
+	if srs := m.SRS(); srs != "+init=epsg:4326" {
+		t.Error("projection not restored", srs)
+	}
+	if extent, ok := m.MaxExtent(); !ok || extent != [4]float64{-180, -90, 180, 90} {
+		t.Error("maximum extent not restored", extent)
+	}
+}
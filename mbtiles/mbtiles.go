@@ -0,0 +1,193 @@
+// Package mbtiles reads and writes tiles of MBTiles files (https://github.com/mapbox/mbtiles-spec).
+package mbtiles
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sgelb/go-mapnik"
+
+	// registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ErrNotFound is returned for tiles that are not in the MBTiles file.
+var ErrNotFound = errors.New("mbtiles: tile not found")
+
+// Reader reads tiles from an MBTiles file. It is safe for concurrent use.
+type Reader struct {
+	db *sql.DB
+}
+
+// Open opens the MBTiles file at path read-only.
+func Open(path string) (*Reader, error) {
+	db, err := sql.Open("sqlite3", "file:"+url.PathEscape(path)+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("mbtiles: %v", err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'tiles'").Scan(&n); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("mbtiles: %s: %v", path, err)
+	}
+	if n == 0 {
+		db.Close()
+		return nil, fmt.Errorf("mbtiles: %s: missing tiles table", path)
+	}
+	return &Reader{db: db}, nil
+}
+
+// Close closes the file.
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+// Tile returns the tile z/x/y. y counts from the north like in XYZ tile URLs, it is converted
+// to the TMS scheme of MBTiles. Vector tiles are usually gzip compressed.
+func (r *Reader) Tile(z, x, y int) ([]byte, error) {
+	var data []byte
+	err := r.db.QueryRow("SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?",
+		z, x, (1<<uint(z))-1-y).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("mbtiles: %v", err)
+	}
+	return data, nil
+}
+
+// Metadata describes the tileset of an MBTiles file.
+type Metadata struct {
+	Name        string
+	Description string
+	Attribution string
+	// Format of the tiles: png, jpg, webp or pbf for vector tiles.
+	Format string
+	// Type is baselayer or overlay.
+	Type string
+	// Bounds are minLon, minLat, maxLon, maxLat of the tiles.
+	Bounds [4]float64
+	// Center is the lon, lat and zoom level of the default view.
+	Center  [3]float64
+	MinZoom int
+	MaxZoom int
+	// JSON describes the layers of vector tiles.
+	JSON string
+	// Other contains all other name/value pairs of the metadata table.
+	Other map[string]string
+}
+
+// values returns the name/value pairs of the metadata table, without empty values.
+func (md *Metadata) values() map[string]string {
+	v := map[string]string{}
+	for k, val := range md.Other {
+		v[k] = val
+	}
+	for k, val := range map[string]string{
+		"name":        md.Name,
+		"description": md.Description,
+		"attribution": md.Attribution,
+		"format":      md.Format,
+		"type":        md.Type,
+		"json":        md.JSON,
+	} {
+		if val != "" {
+			v[k] = val
+		}
+	}
+	if md.Bounds != [4]float64{} {
+		v["bounds"] = formatFloats(md.Bounds[:])
+	}
+	if md.Center != [3]float64{} {
+		v["center"] = formatFloats(md.Center[:])
+	}
+	if md.MinZoom != 0 || md.MaxZoom != 0 {
+		v["minzoom"] = strconv.Itoa(md.MinZoom)
+		v["maxzoom"] = strconv.Itoa(md.MaxZoom)
+	}
+	return v
+}
+
+func formatFloats(fs []float64) string {
+	s := make([]string, len(fs))
+	for i, f := range fs {
+		s[i] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strings.Join(s, ",")
+}
+
+func parseFloats(s string, fs []float64) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != len(fs) {
+		return fmt.Errorf("expected %d values, got %q", len(fs), s)
+	}
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return err
+		}
+		fs[i] = f
+	}
+	return nil
+}
+
+// Metadata returns the content of the metadata table.
+func (r *Reader) Metadata() (*Metadata, error) {
+	rows, err := r.db.Query("SELECT name, value FROM metadata")
+	if err != nil {
+		return nil, fmt.Errorf("mbtiles: %v", err)
+	}
+	defer rows.Close()
+	md := &Metadata{Other: map[string]string{}}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("mbtiles: %v", err)
+		}
+		switch name {
+		case "name":
+			md.Name = value
+		case "description":
+			md.Description = value
+		case "attribution":
+			md.Attribution = value
+		case "format":
+			md.Format = value
+		case "type":
+			md.Type = value
+		case "json":
+			md.JSON = value
+		case "bounds":
+			err = parseFloats(value, md.Bounds[:])
+		case "center":
+			err = parseFloats(value, md.Center[:])
+		case "minzoom":
+			md.MinZoom, err = strconv.Atoi(value)
+		case "maxzoom":
+			md.MaxZoom, err = strconv.Atoi(value)
+		default:
+			md.Other[name] = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mbtiles: invalid metadata %s: %v", name, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mbtiles: %v", err)
+	}
+	return md, nil
+}
+
+// Datasource returns a datasource with the features of a layer of the vector tile z/x/y.
+// See mapnik.NewVectorTileDatasource.
+func (r *Reader) Datasource(z, x, y int, layer string) (*mapnik.Datasource, error) {
+	data, err := r.Tile(z, x, y)
+	if err != nil {
+		return nil, err
+	}
+	return mapnik.NewVectorTileDatasource(data, z, x, y, layer)
+}
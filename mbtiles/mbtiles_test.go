@@ -0,0 +1,211 @@
+package mbtiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"image/png"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+// createMBTiles writes an MBTiles file with a single vector tile 1/1/0.
+func createMBTiles(t *testing.T) (string, []byte) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tile := mapnik.EncodeVectorTile([]mapnik.VectorTileLayer{{
+		Name:     "points",
+		Extent:   4096,
+		Features: []mapnik.Feature{{ID: 1, Geometry: mapnik.Point{X: 2048, Y: 2048}, Properties: map[string]interface{}{"name": "a"}}},
+	}})
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write(tile)
+	gz.Close()
+
+	if err := w.PutTile(1, 1, 0, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetMetadata(testMetadata); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, buf.Bytes()
+}
+
+var testMetadata = Metadata{
+	Name:        "test",
+	Attribution: "© OpenStreetMap contributors",
+	Format:      "pbf",
+	Bounds:      [4]float64{0, 0, 180, 85.0511},
+	Center:      [3]float64{90, 42.5, 1},
+	MinZoom:     1,
+	MaxZoom:     1,
+	Other:       map[string]string{"generator": "go-mapnik"},
+}
+
+func TestReader(t *testing.T) {
+	path, expected := createMBTiles(t)
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	data, err := r.Tile(1, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, data) {
+		t.Error("unexpected tile data")
+	}
+	if _, err := r.Tile(1, 1, 1); err != ErrNotFound {
+		t.Error("expected ErrNotFound, got", err)
+	}
+
+	md, err := r.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&testMetadata, md) {
+		t.Error("unexpected metadata", md)
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mbtiles")); err == nil {
+		t.Error("missing file did not return an error")
+	}
+}
+
+func TestDatasource(t *testing.T) {
+	if mapnik.Version.Major < 3 {
+		t.Skip("feature queries require Mapnik 3")
+	}
+	path, _ := createMBTiles(t)
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ds, err := r.Datasource(1, 1, 0, "points")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Free()
+	features, err := ds.Features(-1e8, -1e8, 1e8, 1e8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 1 || features[0].Properties["name"] != "a" {
+		t.Fatal("unexpected features", features)
+	}
+	// center of the tile 1/1/0
+	p := features[0].Geometry.(mapnik.Point)
+	if p.X < 10018754 || p.X > 10018755 || p.Y < 10018754 || p.Y > 10018755 {
+		t.Error("unexpected geometry", p)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < batchSize+10; i++ {
+		if err := w.PutTile(12, i, 7, []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// replaces the first tile
+	if err := w.PutTile(12, 0, 7, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening keeps existing tiles
+	w, err = Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := w.HasTile(12, 0, 7); err != nil || !ok {
+		t.Error("existing tile not found", err)
+	}
+	if ok, err := w.HasTile(12, 0, 8); err != nil || ok {
+		t.Error("missing tile found", err)
+	}
+	if err := w.PutTile(0, 0, 0, []byte("root")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, tt := range []struct {
+		z, x, y  int
+		expected string
+	}{
+		{12, 0, 7, "new"},
+		{12, batchSize + 9, 7, strconv.Itoa(batchSize + 9)},
+		{0, 0, 0, "root"},
+	} {
+		data, err := r.Tile(tt.z, tt.x, tt.y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("unexpected tile %d/%d/%d: %q", tt.z, tt.x, tt.y, data)
+		}
+	}
+}
+
+func TestRenderTile(t *testing.T) {
+	m := mapnik.New()
+	if err := m.Load("../test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RenderTile(m, 4, 8, 5, mapnik.RenderOpts{Format: "png"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := r.Tile(4, 8, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != mapnik.TileSize || img.Bounds().Dy() != mapnik.TileSize {
+		t.Error("unexpected tile size", img.Bounds())
+	}
+}
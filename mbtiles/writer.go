@@ -0,0 +1,154 @@
+package mbtiles
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+// batchSize is the number of tiles written in one transaction.
+const batchSize = 1000
+
+const schema = `
+CREATE TABLE IF NOT EXISTS metadata (name text, value text);
+CREATE UNIQUE INDEX IF NOT EXISTS metadata_name ON metadata (name);
+CREATE TABLE IF NOT EXISTS tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+CREATE UNIQUE INDEX IF NOT EXISTS tile_index ON tiles (zoom_level, tile_column, tile_row);
+`
+
+// Writer writes tiles into an MBTiles file. Tiles are written in batches, they are only
+// guaranteed to be stored after Flush or Close. It is safe for concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	db      *sql.DB
+	tx      *sql.Tx
+	pending int
+}
+
+// Create opens the MBTiles file at path for writing. The file is created if it does not exist,
+// tiles of an existing file are kept.
+func Create(path string) (*Writer, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("mbtiles: %v", err)
+	}
+	// sqlite does not support concurrent writes
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("mbtiles: %s: %v", path, err)
+	}
+	return &Writer{db: db}, nil
+}
+
+// PutTile stores the tile z/x/y, replacing an existing tile. y counts from the north like
+// in XYZ tile URLs.
+func (w *Writer) PutTile(z, x, y int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.tx == nil {
+		tx, err := w.db.Begin()
+		if err != nil {
+			return fmt.Errorf("mbtiles: %v", err)
+		}
+		w.tx = tx
+	}
+	_, err := w.tx.Exec("INSERT OR REPLACE INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)",
+		z, x, (1<<uint(z))-1-y, data)
+	if err != nil {
+		return fmt.Errorf("mbtiles: %v", err)
+	}
+	w.pending++
+	if w.pending >= batchSize {
+		return w.commit()
+	}
+	return nil
+}
+
+// HasTile returns whether the tile z/x/y is stored, including pending tiles.
+func (w *Writer) HasTile(z, x, y int) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	q := w.db.QueryRow
+	if w.tx != nil {
+		q = w.tx.QueryRow
+	}
+	var n int
+	err := q("SELECT count(*) FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?",
+		z, x, (1<<uint(z))-1-y).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("mbtiles: %v", err)
+	}
+	return n > 0, nil
+}
+
+// RenderTile renders the tile z/x/y with mapnik.Map.RenderTile and stores it.
+func (w *Writer) RenderTile(m *mapnik.Map, z, x, y int, opts mapnik.RenderOpts) error {
+	data, err := m.RenderTile(z, x, y, opts)
+	if err != nil {
+		return err
+	}
+	return w.PutTile(z, x, y, data)
+}
+
+// SetMetadata replaces the metadata. Empty fields are not written.
+func (w *Writer) SetMetadata(md Metadata) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// the only connection is used by the transaction of pending tiles
+	if err := w.commit(); err != nil {
+		return err
+	}
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("mbtiles: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM metadata"); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("mbtiles: %v", err)
+	}
+	for name, value := range md.values() {
+		if _, err := tx.Exec("INSERT INTO metadata (name, value) VALUES (?, ?)", name, value); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("mbtiles: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("mbtiles: %v", err)
+	}
+	return nil
+}
+
+// commit commits pending tiles. w.mu must be held.
+func (w *Writer) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+	err := w.tx.Commit()
+	w.tx = nil
+	w.pending = 0
+	if err != nil {
+		return fmt.Errorf("mbtiles: %v", err)
+	}
+	return nil
+}
+
+// Flush stores all pending tiles.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.commit()
+}
+
+// Close stores all pending tiles and closes the file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.commit()
+	if cerr := w.db.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("mbtiles: %v", cerr)
+	}
+	return err
+}
@@ -0,0 +1,590 @@
+package mapnik
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Mapbox Vector Tile encoding as specified in https://github.com/mapbox/vector-tile-spec (version 2).
+
+// VectorTileLayer is a layer of a Mapbox Vector Tile. Feature geometries are in tile
+// coordinates from 0 to Extent, with y pointing down.
+type VectorTileLayer struct {
+	Name     string
+	Extent   int
+	Features []Feature
+}
+
+// MVT geometry types
+const (
+	mvtPoint      = 1
+	mvtLineString = 2
+	mvtPolygon    = 3
+)
+
+// MVT geometry commands
+const (
+	mvtMoveTo    = 1
+	mvtLineTo    = 2
+	mvtClosePath = 7
+)
+
+// protobuf wire types
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendKey(b []byte, field, wireType int) []byte {
+	return appendVarint(b, uint64(field<<3|wireType))
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendKey(b, field, pbBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendKey(b, field, pbVarint)
+	return appendVarint(b, v)
+}
+
+func appendPacked(b []byte, field int, vs []uint32) []byte {
+	var p []byte
+	for _, v := range vs {
+		p = appendVarint(p, uint64(v))
+	}
+	return appendBytesField(b, field, p)
+}
+
+func zigzag(v int) uint32 {
+	return uint32((int32(v) << 1) ^ (int32(v) >> 31))
+}
+
+func unzigzag(v uint32) int {
+	return int(int32(v>>1) ^ -int32(v&1))
+}
+
+// EncodeVectorTile encodes the layers as Mapbox Vector Tile. Geometries are rounded to
+// integer tile coordinates. Properties with unsupported types or nil values are omitted.
+func EncodeVectorTile(layers []VectorTileLayer) []byte {
+	var tile []byte
+	for _, l := range layers {
+		tile = appendBytesField(tile, 3, encodeVectorTileLayer(l))
+	}
+	return tile
+}
+
+func encodeVectorTileLayer(l VectorTileLayer) []byte {
+	extent := l.Extent
+	if extent == 0 {
+		extent = 4096
+	}
+	b := appendVarintField(nil, 15, 2)
+	b = appendBytesField(b, 1, []byte(l.Name))
+
+	keys := map[string]uint32{}
+	var keyList []string
+	values := map[interface{}]uint32{}
+	var valueList [][]byte
+
+	for _, f := range l.Features {
+		names := make([]string, 0, len(f.Properties))
+		for k := range f.Properties {
+			names = append(names, k)
+		}
+		// sorted for a deterministic output
+		sort.Strings(names)
+
+		var tags []uint32
+		for _, k := range names {
+			enc, key := encodeVectorTileValue(f.Properties[k])
+			if enc == nil {
+				continue
+			}
+			ki, ok := keys[k]
+			if !ok {
+				ki = uint32(len(keyList))
+				keys[k] = ki
+				keyList = append(keyList, k)
+			}
+			vi, ok := values[key]
+			if !ok {
+				vi = uint32(len(valueList))
+				values[key] = vi
+				valueList = append(valueList, enc)
+			}
+			tags = append(tags, ki, vi)
+		}
+
+		geoms := []Geometry{f.Geometry}
+		if gc, ok := f.Geometry.(GeometryCollection); ok {
+			geoms = gc
+		}
+		for _, g := range geoms {
+			typ, cmds := encodeVectorTileGeometry(g)
+			if len(cmds) == 0 {
+				continue
+			}
+			var fb []byte
+			if f.ID > 0 {
+				fb = appendVarintField(fb, 1, uint64(f.ID))
+			}
+			if len(tags) > 0 {
+				fb = appendPacked(fb, 2, tags)
+			}
+			fb = appendVarintField(fb, 3, uint64(typ))
+			fb = appendPacked(fb, 4, cmds)
+			b = appendBytesField(b, 2, fb)
+		}
+	}
+
+	for _, k := range keyList {
+		b = appendBytesField(b, 3, []byte(k))
+	}
+	for _, v := range valueList {
+		b = appendBytesField(b, 4, v)
+	}
+	return appendVarintField(b, 5, uint64(extent))
+}
+
+// encodeVectorTileValue returns the encoded value message and a key to deduplicate values,
+// or nil for unsupported values.
+func encodeVectorTileValue(v interface{}) ([]byte, interface{}) {
+	switch v := v.(type) {
+	case string:
+		return appendBytesField(nil, 1, []byte(v)), v
+	case float32:
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+		return append(appendKey(nil, 2, pbFixed32), buf[:]...), v
+	case float64:
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+		return append(appendKey(nil, 3, pbFixed64), buf[:]...), v
+	case int:
+		return appendVarintField(nil, 4, uint64(v)), int64(v)
+	case int32:
+		return appendVarintField(nil, 4, uint64(v)), int64(v)
+	case int64:
+		return appendVarintField(nil, 4, uint64(v)), v
+	case uint32:
+		return appendVarintField(nil, 5, uint64(v)), uint64(v)
+	case uint64:
+		return appendVarintField(nil, 5, v), v
+	case bool:
+		b := uint64(0)
+		if v {
+			b = 1
+		}
+		return appendVarintField(nil, 7, b), v
+	}
+	return nil, nil
+}
+
+// geometryEncoder writes MVT geometry commands with delta encoded coordinates.
+type geometryEncoder struct {
+	cmds []uint32
+	x, y int
+}
+
+func (e *geometryEncoder) command(id, count int) {
+	e.cmds = append(e.cmds, uint32(id&7|count<<3))
+}
+
+func (e *geometryEncoder) coord(c Coord) {
+	x, y := int(math.Round(c.X)), int(math.Round(c.Y))
+	e.cmds = append(e.cmds, zigzag(x-e.x), zigzag(y-e.y))
+	e.x, e.y = x, y
+}
+
+func (e *geometryEncoder) line(cs []Coord) {
+	e.command(mvtMoveTo, 1)
+	e.coord(cs[0])
+	e.command(mvtLineTo, len(cs)-1)
+	for _, c := range cs[1:] {
+		e.coord(c)
+	}
+}
+
+// ring writes a ring with the given orientation, without its closing point.
+func (e *geometryEncoder) ring(cs []Coord, exterior bool) {
+	cs = cs[:len(cs)-1]
+	if (ringArea(cs) > 0) != exterior {
+		r := make([]Coord, len(cs))
+		for i, c := range cs {
+			r[len(cs)-1-i] = c
+		}
+		cs = r
+	}
+	e.line(cs)
+	e.command(mvtClosePath, 1)
+}
+
+func (e *geometryEncoder) polygon(p Polygon) {
+	for i, r := range p {
+		if len(r) < 4 {
+			if i == 0 {
+				return
+			}
+			continue
+		}
+		e.ring(r, i == 0)
+	}
+}
+
+// ringArea returns the signed area of the ring, positive for clockwise rings in tile coordinates.
+func ringArea(cs []Coord) float64 {
+	a := 0.0
+	for i := range cs {
+		j := (i + 1) % len(cs)
+		a += cs[i].X*cs[j].Y - cs[j].X*cs[i].Y
+	}
+	return a / 2
+}
+
+// encodeVectorTileGeometry returns the MVT type and commands of the geometry. Exterior
+// rings are written clockwise and interior rings counter-clockwise, as the spec requires.
+func encodeVectorTileGeometry(g Geometry) (int, []uint32) {
+	e := &geometryEncoder{}
+	switch g := g.(type) {
+	case Point:
+		e.command(mvtMoveTo, 1)
+		e.coord(Coord(g))
+		return mvtPoint, e.cmds
+	case MultiPoint:
+		if len(g) > 0 {
+			e.command(mvtMoveTo, len(g))
+			for _, c := range g {
+				e.coord(c)
+			}
+		}
+		return mvtPoint, e.cmds
+	case LineString:
+		if len(g) > 1 {
+			e.line(g)
+		}
+		return mvtLineString, e.cmds
+	case MultiLineString:
+		for _, l := range g {
+			if len(l) > 1 {
+				e.line(l)
+			}
+		}
+		return mvtLineString, e.cmds
+	case Polygon:
+		e.polygon(g)
+		return mvtPolygon, e.cmds
+	case MultiPolygon:
+		for _, p := range g {
+			e.polygon(p)
+		}
+		return mvtPolygon, e.cmds
+	}
+	return 0, nil
+}
+
+// pbReader reads protobuf messages.
+type pbReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *pbReader) fail(msg string) {
+	if r.err == nil {
+		r.err = errors.New("mapnik: invalid vector tile: " + msg)
+	}
+}
+
+func (r *pbReader) done() bool {
+	return r.err != nil || r.pos >= len(r.b)
+}
+
+func (r *pbReader) varint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		r.fail("truncated varint")
+		r.pos = len(r.b)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *pbReader) next(n int) []byte {
+	if n < 0 || r.pos+n > len(r.b) {
+		r.fail("truncated message")
+		r.pos = len(r.b)
+		return nil
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// field returns the number and wire type of the next field.
+func (r *pbReader) field() (int, int) {
+	k := r.varint()
+	return int(k >> 3), int(k & 7)
+}
+
+func (r *pbReader) bytes() []byte {
+	return r.next(int(r.varint()))
+}
+
+func (r *pbReader) skip(wireType int) {
+	switch wireType {
+	case pbVarint:
+		r.varint()
+	case pbFixed64:
+		r.next(8)
+	case pbBytes:
+		r.bytes()
+	case pbFixed32:
+		r.next(4)
+	default:
+		r.fail(fmt.Sprintf("unsupported wire type %d", wireType))
+	}
+}
+
+func (r *pbReader) packed() []uint32 {
+	p := &pbReader{b: r.bytes()}
+	var vs []uint32
+	for !p.done() {
+		vs = append(vs, uint32(p.varint()))
+	}
+	if p.err != nil {
+		r.err = p.err
+	}
+	return vs
+}
+
+// DecodeVectorTile decodes the layers of a Mapbox Vector Tile.
+func DecodeVectorTile(b []byte) ([]VectorTileLayer, error) {
+	r := &pbReader{b: b}
+	layers := []VectorTileLayer{}
+	for !r.done() {
+		field, wireType := r.field()
+		if field == 3 && wireType == pbBytes {
+			l, err := decodeVectorTileLayer(r.bytes())
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, l)
+			continue
+		}
+		r.skip(wireType)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return layers, nil
+}
+
+type mvtFeature struct {
+	id       uint64
+	tags     []uint32
+	typ      int
+	geometry []uint32
+}
+
+func decodeVectorTileLayer(b []byte) (VectorTileLayer, error) {
+	l := VectorTileLayer{Extent: 4096}
+	var keys []string
+	var values []interface{}
+	var features []mvtFeature
+
+	r := &pbReader{b: b}
+	for !r.done() {
+		field, wireType := r.field()
+		switch {
+		case field == 1 && wireType == pbBytes:
+			l.Name = string(r.bytes())
+		case field == 2 && wireType == pbBytes:
+			features = append(features, decodeVectorTileFeature(r, r.bytes()))
+		case field == 3 && wireType == pbBytes:
+			keys = append(keys, string(r.bytes()))
+		case field == 4 && wireType == pbBytes:
+			values = append(values, decodeVectorTileValue(r, r.bytes()))
+		case field == 5 && wireType == pbVarint:
+			l.Extent = int(r.varint())
+		default:
+			r.skip(wireType)
+		}
+	}
+	if r.err != nil {
+		return l, r.err
+	}
+
+	l.Features = make([]Feature, 0, len(features))
+	for _, f := range features {
+		if len(f.tags)%2 != 0 {
+			return l, fmt.Errorf("mapnik: invalid vector tile: odd number of tags in layer %q", l.Name)
+		}
+		props := make(map[string]interface{}, len(f.tags)/2)
+		for i := 0; i < len(f.tags); i += 2 {
+			if int(f.tags[i]) >= len(keys) || int(f.tags[i+1]) >= len(values) {
+				return l, fmt.Errorf("mapnik: invalid vector tile: tag out of range in layer %q", l.Name)
+			}
+			props[keys[f.tags[i]]] = values[f.tags[i+1]]
+		}
+		g, err := decodeVectorTileGeometry(f.typ, f.geometry)
+		if err != nil {
+			return l, fmt.Errorf("mapnik: invalid vector tile: %v in layer %q", err, l.Name)
+		}
+		if g == nil {
+			continue
+		}
+		l.Features = append(l.Features, Feature{ID: int64(f.id), Geometry: g, Properties: props})
+	}
+	return l, nil
+}
+
+func decodeVectorTileFeature(parent *pbReader, b []byte) mvtFeature {
+	var f mvtFeature
+	r := &pbReader{b: b}
+	for !r.done() {
+		field, wireType := r.field()
+		switch {
+		case field == 1 && wireType == pbVarint:
+			f.id = r.varint()
+		case field == 2 && wireType == pbBytes:
+			f.tags = r.packed()
+		case field == 3 && wireType == pbVarint:
+			f.typ = int(r.varint())
+		case field == 4 && wireType == pbBytes:
+			f.geometry = r.packed()
+		default:
+			r.skip(wireType)
+		}
+	}
+	if r.err != nil && parent.err == nil {
+		parent.err = r.err
+	}
+	return f
+}
+
+func decodeVectorTileValue(parent *pbReader, b []byte) interface{} {
+	var v interface{}
+	r := &pbReader{b: b}
+	for !r.done() {
+		field, wireType := r.field()
+		switch {
+		case field == 1 && wireType == pbBytes:
+			v = string(r.bytes())
+		case field == 2 && wireType == pbFixed32:
+			if buf := r.next(4); buf != nil {
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf)))
+			}
+		case field == 3 && wireType == pbFixed64:
+			if buf := r.next(8); buf != nil {
+				v = math.Float64frombits(binary.LittleEndian.Uint64(buf))
+			}
+		case field == 4 && wireType == pbVarint:
+			v = int64(r.varint())
+		case field == 5 && wireType == pbVarint:
+			v = int64(r.varint())
+		case field == 6 && wireType == pbVarint:
+			u := r.varint()
+			v = int64(u>>1) ^ -int64(u&1)
+		case field == 7 && wireType == pbVarint:
+			v = r.varint() != 0
+		default:
+			r.skip(wireType)
+		}
+	}
+	if r.err != nil && parent.err == nil {
+		parent.err = r.err
+	}
+	return v
+}
+
+// decodeVectorTileGeometry decodes geometry commands. Polygons start with each
+// exterior (clockwise) ring. Returns nil for unknown geometry types.
+func decodeVectorTileGeometry(typ int, cmds []uint32) (Geometry, error) {
+	var lines [][]Coord
+	x, y := 0, 0
+	for i := 0; i < len(cmds); {
+		id, count := int(cmds[i]&7), int(cmds[i]>>3)
+		i++
+		switch id {
+		case mvtMoveTo, mvtLineTo:
+			if i+2*count > len(cmds) {
+				return nil, errors.New("truncated geometry")
+			}
+			for j := 0; j < count; j++ {
+				x += unzigzag(cmds[i])
+				y += unzigzag(cmds[i+1])
+				i += 2
+				c := Coord{float64(x), float64(y)}
+				if id == mvtMoveTo || len(lines) == 0 {
+					lines = append(lines, []Coord{c})
+				} else {
+					lines[len(lines)-1] = append(lines[len(lines)-1], c)
+				}
+			}
+		case mvtClosePath:
+			if len(lines) == 0 {
+				return nil, errors.New("ClosePath without MoveTo")
+			}
+			l := lines[len(lines)-1]
+			lines[len(lines)-1] = append(l, l[0])
+		default:
+			return nil, fmt.Errorf("unknown command %d", id)
+		}
+	}
+
+	switch typ {
+	case mvtPoint:
+		if len(lines) == 1 {
+			return Point(lines[0][0]), nil
+		}
+		mp := MultiPoint{}
+		for _, l := range lines {
+			mp = append(mp, l...)
+		}
+		return mp, nil
+	case mvtLineString:
+		if len(lines) == 1 {
+			return LineString(lines[0]), nil
+		}
+		ml := make(MultiLineString, len(lines))
+		for i, l := range lines {
+			ml[i] = l
+		}
+		return ml, nil
+	case mvtPolygon:
+		mp := MultiPolygon{}
+		for _, r := range lines {
+			a := ringArea(r)
+			if a == 0 {
+				continue
+			}
+			if a > 0 || len(mp) == 0 {
+				mp = append(mp, Polygon{r})
+			} else {
+				mp[len(mp)-1] = append(mp[len(mp)-1], r)
+			}
+		}
+		if len(mp) == 1 {
+			return mp[0], nil
+		}
+		return mp, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,121 @@
+package mapnik
+
+// #include "mapnik_c_api.h"
+import "C"
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Plugin is a registered datasource input plugin.
+type Plugin struct {
+	// Name is the type used in datasource parameters, e.g. "gdal".
+	Name string
+	// Path is the plugin file. Empty for plugins linked into libmapnik.
+	Path string
+}
+
+// Plugins returns the input plugins registered with RegisterDatasources, sorted by name.
+func Plugins() []Plugin {
+	names := goStrings(C.mapnik_plugin_names())
+	dirs := goStrings(C.mapnik_plugin_directories())
+	sort.Strings(names)
+	plugins := make([]Plugin, len(names))
+	for i, name := range names {
+		plugins[i].Name = name
+		for _, dir := range dirs {
+			path := filepath.Join(dir, name+".input")
+			if _, err := os.Stat(path); err == nil {
+				plugins[i].Path = path
+				break
+			}
+		}
+	}
+	return plugins
+}
+
+// Features describes what the linked Mapnik library supports.
+type Features struct {
+	// Version is the Mapnik version, e.g. "3.0.22".
+	Version string
+	// ImageFormats are the supported image formats out of png, jpeg, webp and tiff.
+	ImageFormats []string
+	// Cairo is true if Mapnik was built with the cairo renderer (PDF, SVG and PS output).
+	Cairo bool
+	// Grid is true if Mapnik was built with the grid renderer (UTFGrid).
+	Grid bool
+	// Proj is true if Mapnik was built with proj and supports projections other than
+	// WGS84 and web mercator.
+	Proj bool
+	// Plugins are the registered input plugins.
+	Plugins []Plugin
+}
+
+// Capabilities returns the features of the linked Mapnik library and the registered plugins.
+func Capabilities() Features {
+	flags := C.mapnik_features()
+	f := Features{
+		Version: Version.String,
+		Cairo:   flags&C.MAPNIK_FEATURE_CAIRO != 0,
+		Grid:    flags&C.MAPNIK_FEATURE_GRID != 0,
+		Proj:    flags&C.MAPNIK_FEATURE_PROJ != 0,
+		Plugins: Plugins(),
+	}
+	for _, format := range []struct {
+		name string
+		flag C.int
+	}{
+		{"png", C.MAPNIK_FEATURE_PNG},
+		{"jpeg", C.MAPNIK_FEATURE_JPEG},
+		{"webp", C.MAPNIK_FEATURE_WEBP},
+		{"tiff", C.MAPNIK_FEATURE_TIFF},
+	} {
+		if flags&format.flag != 0 {
+			f.ImageFormats = append(f.ImageFormats, format.name)
+		}
+	}
+	return f
+}
+
+// Has returns true if name is a registered plugin, a supported image format or one of cairo,
+// grid and proj.
+func (f Features) Has(name string) bool {
+	switch name {
+	case "cairo":
+		return f.Cairo
+	case "grid":
+		return f.Grid
+	case "proj":
+		return f.Proj
+	}
+	for _, format := range f.ImageFormats {
+		if format == name {
+			return true
+		}
+	}
+	for _, p := range f.Plugins {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Require returns an error listing all names that are not available, see Has. Use it to
+// fail at startup, e.g. Capabilities().Require("gdal", "webp").
+func (f Features) Require(names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if !f.Has(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("mapnik: missing " + strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package mapnik
+
+import "testing"
+
+func TestPlugins(t *testing.T) {
+	plugins := Plugins()
+	if len(plugins) == 0 {
+		t.Fatal("no plugins registered")
+	}
+	for i, p := range plugins {
+		if i > 0 && plugins[i-1].Name > p.Name {
+			t.Error("plugins not sorted", p)
+		}
+	}
+	// test/map.xml uses the geojson plugin
+	if err := Capabilities().Require("geojson"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	c := Capabilities()
+	if c.Version != Version.String {
+		t.Error("unexpected version", c.Version)
+	}
+	if !c.Has("png") {
+		t.Error("png not supported", c.ImageFormats)
+	}
+	err := c.Require("png", "nonexistent", "gif")
+	if err == nil || err.Error() != "mapnik: missing nonexistent, gif" {
+		t.Error("unexpected error", err)
+	}
+}
@@ -0,0 +1,317 @@
+// Package seed pre-renders raster tiles of a map into a tile store.
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+// Store stores rendered tiles. y counts from the north like in XYZ tile URLs.
+type Store interface {
+	// Has returns whether the tile z/x/y is already stored.
+	Has(z, x, y int) (bool, error)
+	// Put stores the tile z/x/y.
+	Put(z, x, y int, data []byte) error
+}
+
+// SolidStore is implemented by stores that store identical blank and single color tiles once,
+// e.g. ocean tiles, and reference them for each tile.
+type SolidStore interface {
+	Store
+	// PutSolid stores the tile z/x/y with the single color c. data is the encoded tile.
+	PutSolid(z, x, y int, c color.NRGBA, data []byte) error
+}
+
+// Options defines the tiles to seed.
+type Options struct {
+	MinZoom, MaxZoom int
+	// BBox limits the tiles to minLon, minLat, maxLon, maxLat. Defaults to the whole world.
+	BBox *[4]float64
+	// Polygon limits the tiles to those intersecting a mapnik.Polygon or mapnik.MultiPolygon
+	// in lon/lat. Can be combined with BBox.
+	Polygon mapnik.Geometry
+	// NewMap returns a new Map for each worker. Maps are not safe for concurrent use.
+	NewMap func() (*mapnik.Map, error)
+	// Workers is the number of concurrently rendering maps. Defaults to the number of CPUs.
+	Workers int
+	// RenderOpts are passed to mapnik.Map.RenderTile.
+	RenderOpts mapnik.RenderOpts
+	// ShareSolid stores blank and single color tiles with PutSolid if the store implements
+	// SolidStore. Tiles are rendered as images to detect their colors and encoded afterwards.
+	ShareSolid bool
+	// Resume skips tiles that are already stored, e.g. after an interrupted run.
+	Resume bool
+	// Progress is called every ProgressInterval (default 1s) and once at the end.
+	Progress         func(Progress)
+	ProgressInterval time.Duration
+}
+
+// Stats are the tile counts of a zoom level or of all zoom levels.
+type Stats struct {
+	// Total number of tiles to seed.
+	Total int
+	// Rendered, Skipped (already stored) and Failed tiles.
+	Rendered, Skipped, Failed int
+	// Solid is the number of rendered tiles stored as shared single color tiles.
+	Solid int
+	// Bytes of all rendered tiles.
+	Bytes int64
+}
+
+// Done returns the number of processed tiles.
+func (s Stats) Done() int {
+	return s.Rendered + s.Skipped + s.Failed
+}
+
+func (s *Stats) add(o Stats) {
+	s.Total += o.Total
+	s.Rendered += o.Rendered
+	s.Skipped += o.Skipped
+	s.Failed += o.Failed
+	s.Solid += o.Solid
+	s.Bytes += o.Bytes
+}
+
+// Progress reports the state of a seeding run.
+type Progress struct {
+	Stats
+	// Zooms are the stats per zoom level, from MinZoom to MaxZoom.
+	Zooms   []Stats
+	Elapsed time.Duration
+	// ETA is the estimated remaining time, based on the rate of rendered tiles so far.
+	ETA time.Duration
+}
+
+func (p Progress) String() string {
+	percent := 100.0
+	if p.Total > 0 {
+		percent = float64(p.Done()) / float64(p.Total) * 100
+	}
+	return fmt.Sprintf("%d/%d tiles (%.1f%%), %d rendered, %d skipped, %d failed, elapsed %s, eta %s",
+		p.Done(), p.Total, percent, p.Rendered, p.Skipped, p.Failed,
+		p.Elapsed.Round(time.Second), p.ETA.Round(time.Second))
+}
+
+type tile struct {
+	z, x, y int
+}
+
+// Seed renders all tiles of opts into store. It returns when all tiles are processed or the
+// context is canceled. The returned error reports the number of failed tiles and the first
+// error. Run Seed again with Resume to continue an interrupted run.
+func Seed(ctx context.Context, store Store, opts Options) (Progress, error) {
+	if opts.NewMap == nil {
+		return Progress{}, errors.New("seed: missing NewMap")
+	}
+	if opts.MinZoom < 0 || opts.MaxZoom < opts.MinZoom {
+		return Progress{}, fmt.Errorf("seed: invalid zoom range %d-%d", opts.MinZoom, opts.MaxZoom)
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	maps := make([]*mapnik.Map, workers)
+	for i := range maps {
+		m, err := opts.NewMap()
+		if err != nil {
+			for _, m := range maps[:i] {
+				m.Free()
+			}
+			return Progress{}, err
+		}
+		maps[i] = m
+	}
+
+	s := &state{
+		start:   time.Now(),
+		minZoom: opts.MinZoom,
+		zooms:   make([]Stats, opts.MaxZoom-opts.MinZoom+1),
+		solid:   map[color.NRGBA][]byte{},
+	}
+	eachTile(opts, func(t tile) bool {
+		s.zooms[t.z-opts.MinZoom].Total++
+		return true
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tiles := make(chan tile)
+	go func() {
+		defer close(tiles)
+		eachTile(opts, func(t tile) bool {
+			select {
+			case tiles <- t:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for _, m := range maps {
+		wg.Add(1)
+		go func(m *mapnik.Map) {
+			defer wg.Done()
+			defer m.Free()
+			for t := range tiles {
+				s.render(store, m, t, opts)
+			}
+		}(m)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-ticker.C:
+			if opts.Progress != nil {
+				opts.Progress(s.progress())
+			}
+		}
+	}
+
+	p := s.progress()
+	if opts.Progress != nil {
+		opts.Progress(p)
+	}
+	if s.err != nil {
+		return p, fmt.Errorf("seed: %d tiles failed, first error: %v", p.Failed, s.err)
+	}
+	return p, ctx.Err()
+}
+
+// state collects the stats of all workers.
+type state struct {
+	mu      sync.Mutex
+	start   time.Time
+	minZoom int
+	zooms   []Stats
+	err     error
+	// solid are the encoded single color tiles by color
+	solid map[color.NRGBA][]byte
+}
+
+func (s *state) render(store Store, m *mapnik.Map, t tile, opts Options) {
+	var st Stats
+	err := func() error {
+		if opts.Resume {
+			ok, err := store.Has(t.z, t.x, t.y)
+			if err != nil {
+				return err
+			}
+			if ok {
+				st.Skipped = 1
+				return nil
+			}
+		}
+		var data []byte
+		var err error
+		if ss, ok := store.(SolidStore); ok && opts.ShareSolid {
+			var solid bool
+			if data, solid, err = s.renderSolid(ss, m, t, opts.RenderOpts); solid {
+				st.Solid = 1
+			}
+		} else if data, err = m.RenderTile(t.z, t.x, t.y, opts.RenderOpts); err == nil {
+			err = store.Put(t.z, t.x, t.y, data)
+		}
+		if err != nil {
+			return err
+		}
+		st.Rendered = 1
+		st.Bytes = int64(len(data))
+		return nil
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		st.Failed = 1
+		if s.err == nil {
+			s.err = fmt.Errorf("tile %d/%d/%d: %v", t.z, t.x, t.y, err)
+		}
+	}
+	s.zooms[t.z-s.minZoom].add(st)
+}
+
+// renderSolid renders the tile as image and stores single color tiles with PutSolid.
+func (s *state) renderSolid(store SolidStore, m *mapnik.Map, t tile, opts mapnik.RenderOpts) ([]byte, bool, error) {
+	// the default format of mapnik.Map.Render
+	format := opts.Format
+	if format == "" {
+		format = "png256"
+	}
+	img, err := m.RenderTileImage(t.z, t.x, t.y, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	c, solid := mapnik.SolidColor(img)
+	var data []byte
+	if solid {
+		data, err = s.encodeSolid(c, img, format)
+	} else {
+		data, err = mapnik.Encode(img, format)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if solid {
+		err = store.PutSolid(t.z, t.x, t.y, c, data)
+	} else {
+		err = store.Put(t.z, t.x, t.y, data)
+	}
+	return data, solid && err == nil, err
+}
+
+// encodeSolid encodes each single color tile only once.
+func (s *state) encodeSolid(c color.NRGBA, img *image.NRGBA, format string) ([]byte, error) {
+	s.mu.Lock()
+	data, ok := s.solid[c]
+	s.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+	data, err := mapnik.Encode(img, format)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.solid[c] = data
+	s.mu.Unlock()
+	return data, nil
+}
+
+func (s *state) progress() Progress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := Progress{Zooms: append([]Stats(nil), s.zooms...), Elapsed: time.Since(s.start)}
+	for _, z := range s.zooms {
+		p.add(z)
+	}
+	// skipped tiles take no time, so the rate is based on rendered tiles only
+	if rendered := p.Rendered + p.Failed; rendered > 0 {
+		remaining := p.Total - p.Done()
+		p.ETA = time.Duration(float64(p.Elapsed) / float64(rendered) * float64(remaining))
+	}
+	return p
+}
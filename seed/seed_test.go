@@ -0,0 +1,124 @@
+package seed
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/cache"
+)
+
+func countTiles(opts Options) int {
+	n := 0
+	eachTile(opts, func(tile) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestEachTile(t *testing.T) {
+	tests := []struct {
+		opts     Options
+		expected int
+	}{
+		{Options{MinZoom: 0, MaxZoom: 2}, 1 + 4 + 16},
+		{Options{MinZoom: 10, MaxZoom: 10, BBox: &[4]float64{9.98, 53.55, 9.99, 53.56}}, 1},
+		// north western quarter of the world
+		{Options{MinZoom: 2, MaxZoom: 2, BBox: &[4]float64{-179, 1, -1, 85}}, 4},
+		// triangle within the western half of the north western quarter
+		{Options{MinZoom: 2, MaxZoom: 2, Polygon: mapnik.Polygon{{{X: -179, Y: 1}, {X: -179, Y: 85}, {X: -100, Y: 85}, {X: -179, Y: 1}}}}, 2},
+		{Options{MinZoom: 2, MaxZoom: 2, Polygon: mapnik.MultiPolygon{}}, 0},
+	}
+	for _, tt := range tests {
+		if n := countTiles(tt.opts); n != tt.expected {
+			t.Errorf("expected %d tiles, got %d", tt.expected, n)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	newMap := func() (*mapnik.Map, error) {
+		m := mapnik.New()
+		return m, m.Load("../test/map.xml")
+	}
+	store := &DirStore{Dir: t.TempDir(), Ext: "png"}
+	opts := Options{MinZoom: 0, MaxZoom: 2, NewMap: newMap, Workers: 2, Resume: true}
+
+	calls := 0
+	opts.Progress = func(Progress) { calls++ }
+	p, err := Seed(context.Background(), store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 {
+		t.Error("progress not reported")
+	}
+	if p.Total != 21 || p.Rendered != 21 || p.Skipped != 0 || p.Bytes == 0 || len(p.Zooms) != 3 || p.Zooms[2].Rendered != 16 {
+		t.Error("unexpected progress", p)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "2", "3", "1.png")); err != nil {
+		t.Error(err)
+	}
+
+	// resume skips all stored tiles
+	p, err = Seed(context.Background(), store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Rendered != 0 || p.Skipped != 21 {
+		t.Error("unexpected progress", p)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Seed(ctx, store, opts); err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+}
+
+func TestSeedShareSolid(t *testing.T) {
+	newMap := func() (*mapnik.Map, error) {
+		m := mapnik.New()
+		return m, m.Load("../test/map.xml")
+	}
+	store := &DirStore{Dir: t.TempDir(), Ext: "png"}
+	p, err := Seed(context.Background(), store, Options{MinZoom: 0, MaxZoom: 2, NewMap: newMap, ShareSolid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the tiles containing the polygon of the test map are not steelblue
+	if p.Rendered != 21 || p.Solid != 18 {
+		t.Error("unexpected progress", p)
+	}
+	solid, err := filepath.Glob(filepath.Join(store.Dir, "solid", "*.png"))
+	if err != nil || len(solid) != 1 {
+		t.Fatal("expected one solid tile, got", solid, err)
+	}
+	sfi, _ := os.Stat(solid[0])
+	if fi, err := os.Stat(filepath.Join(store.Dir, "2", "0", "0.png")); err != nil || !os.SameFile(fi, sfi) {
+		t.Error("tile not linked to solid tile", err)
+	}
+	if fi, err := os.Stat(filepath.Join(store.Dir, "2", "2", "1.png")); err != nil || os.SameFile(fi, sfi) {
+		t.Error("tile with polygon linked to solid tile", err)
+	}
+}
+
+func TestCacheStore(t *testing.T) {
+	s := &CacheStore{Cache: cache.NewDisk(t.TempDir(), cache.Hashed, 0), Format: "png", Scale: 2}
+	if ok, err := s.Has(1, 0, 1); err != nil || ok {
+		t.Error("missing tile found", err)
+	}
+	if err := s.Put(1, 0, 1, []byte("tile")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Has(1, 0, 1); err != nil || !ok {
+		t.Error("tile not found", err)
+	}
+	data, err := s.Cache.Get(cache.Key{Z: 1, X: 0, Y: 1, Format: "png", Scale: 2})
+	if err != nil || string(data) != "tile" {
+		t.Error("unexpected cached tile", data, err)
+	}
+}
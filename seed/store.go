@@ -0,0 +1,106 @@
+package seed
+
+import (
+	"image/color"
+
+	"github.com/sgelb/go-mapnik/cache"
+	"github.com/sgelb/go-mapnik/mbtiles"
+)
+
+// DirStore stores tiles as files in a Dir/z/x/y.Ext directory tree, the XYZ layout of
+// cache.Disk.
+type DirStore struct {
+	Dir string
+	// Ext is the file extension, e.g. "png".
+	Ext string
+}
+
+func (s *DirStore) disk() *cache.Disk {
+	return cache.NewDisk(s.Dir, cache.XYZ, 0)
+}
+
+func (s *DirStore) key(z, x, y int) cache.Key {
+	return cache.Key{Z: z, X: x, Y: y, Format: s.Ext}
+}
+
+// Has returns whether the tile file exists.
+func (s *DirStore) Has(z, x, y int) (bool, error) {
+	_, err := s.disk().Stat(s.key(z, x, y))
+	if err == cache.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put writes the tile file. The file is written to a temporary file first and renamed, so
+// that interrupted runs leave no partial tiles behind.
+func (s *DirStore) Put(z, x, y int, data []byte) error {
+	return s.disk().Put(s.key(z, x, y), data)
+}
+
+// PutSolid hard links the tile file to the file Dir/solid/rrggbbaa.Ext shared by all tiles
+// of the color c, see cache.Disk.PutSolid.
+func (s *DirStore) PutSolid(z, x, y int, c color.NRGBA, data []byte) error {
+	return s.disk().PutSolid(s.key(z, x, y), c, data)
+}
+
+// MBTilesStore stores tiles in an MBTiles file.
+type MBTilesStore struct {
+	*mbtiles.Writer
+}
+
+// NewMBTilesStore opens or creates the MBTiles file at path. Close the store to write all tiles.
+func NewMBTilesStore(path string) (*MBTilesStore, error) {
+	w, err := mbtiles.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MBTilesStore{w}, nil
+}
+
+// Has returns whether the tile is stored.
+func (s *MBTilesStore) Has(z, x, y int) (bool, error) {
+	return s.HasTile(z, x, y)
+}
+
+// Put stores the tile.
+func (s *MBTilesStore) Put(z, x, y int, data []byte) error {
+	return s.PutTile(z, x, y, data)
+}
+
+// CacheStore stores tiles in a tile cache, e.g. to warm the cache of a tile server.
+// Stale tiles are rendered again when resuming.
+type CacheStore struct {
+	Cache cache.TileCache
+	// Format and Scale of the cache keys, should match Options.RenderOpts.
+	Format string
+	Scale  float64
+}
+
+func (s *CacheStore) key(z, x, y int) cache.Key {
+	return cache.Key{Z: z, X: x, Y: y, Format: s.Format, Scale: s.Scale}
+}
+
+// Has returns whether a fresh tile is cached.
+func (s *CacheStore) Has(z, x, y int) (bool, error) {
+	info, err := s.Cache.Stat(s.key(z, x, y))
+	if err == cache.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !info.Stale, nil
+}
+
+// Put stores the tile in the cache.
+func (s *CacheStore) Put(z, x, y int, data []byte) error {
+	return s.Cache.Put(s.key(z, x, y), data)
+}
+
+// PutSolid stores the tile with cache.SolidCache.PutSolid if the cache supports it.
+func (s *CacheStore) PutSolid(z, x, y int, c color.NRGBA, data []byte) error {
+	if sc, ok := s.Cache.(cache.SolidCache); ok {
+		return sc.PutSolid(s.key(z, x, y), c, data)
+	}
+	return s.Put(z, x, y, data)
+}
@@ -0,0 +1,81 @@
+package seed
+
+import (
+	"math"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/internal/geom"
+)
+
+// eachTile calls fn for all tiles of opts, ordered by zoom level, x and y, until fn returns false.
+func eachTile(opts Options, fn func(tile) bool) {
+	bbox := [4]float64{-180, -mapnik.MaxLat, 180, mapnik.MaxLat}
+	if opts.BBox != nil {
+		bbox = *opts.BBox
+	} else if opts.Polygon != nil {
+		bbox = envelope(opts.Polygon)
+	}
+	if bbox[0] > bbox[2] || bbox[1] > bbox[3] {
+		return
+	}
+	for z := opts.MinZoom; z <= opts.MaxZoom; z++ {
+		minx, miny := mapnik.LonLatToTile(bbox[0], bbox[3], z)
+		maxx, maxy := mapnik.LonLatToTile(bbox[2], bbox[1], z)
+		for x := minx; x <= maxx; x++ {
+			for y := miny; y <= maxy; y++ {
+				if opts.Polygon != nil && !intersects(opts.Polygon, z, x, y) {
+					continue
+				}
+				if !fn(tile{z, x, y}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// polygons returns the polygons of a polygon or multipolygon.
+func polygons(g mapnik.Geometry) []mapnik.Polygon {
+	switch g := g.(type) {
+	case mapnik.Polygon:
+		return []mapnik.Polygon{g}
+	case mapnik.MultiPolygon:
+		return g
+	}
+	return nil
+}
+
+// envelope returns the bounding box of a polygon or multipolygon.
+func envelope(g mapnik.Geometry) [4]float64 {
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range polygons(g) {
+		if len(p) == 0 {
+			continue
+		}
+		for _, c := range p[0] {
+			bbox[0], bbox[1] = math.Min(bbox[0], c.X), math.Min(bbox[1], c.Y)
+			bbox[2], bbox[3] = math.Max(bbox[2], c.X), math.Max(bbox[3], c.Y)
+		}
+	}
+	return bbox
+}
+
+// intersects returns whether the polygon or multipolygon intersects the tile z/x/y.
+func intersects(g mapnik.Geometry, z, x, y int) bool {
+	minLon, minLat, maxLon, maxLat := mapnik.TileLonLatBBox(z, x, y)
+	center := mapnik.Coord{X: (minLon + maxLon) / 2, Y: (minLat + maxLat) / 2}
+	for _, p := range polygons(g) {
+		// the tile is within the polygon, or an edge of the polygon crosses the tile
+		if geom.Contains(p, center) {
+			return true
+		}
+		for _, r := range p {
+			for i := 1; i < len(r); i++ {
+				if geom.SegmentIntersectsBox(r[i-1], r[i], minLon, minLat, maxLon, maxLat) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
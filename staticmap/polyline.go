@@ -0,0 +1,52 @@
+package staticmap
+
+import (
+	"errors"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+// DecodePolyline decodes an encoded polyline with a precision of 5 decimal places
+// (see: https://developers.google.com/maps/documentation/utilities/polylinealgorithm).
+// Returned coordinates are longitude/latitude pairs.
+func DecodePolyline(s string) ([]mapnik.Coord, error) {
+	var coords []mapnik.Coord
+	var lat, lon int
+	for i := 0; i < len(s); {
+		var dlat, dlon int
+		var err error
+		if dlat, i, err = decodeValue(s, i); err != nil {
+			return nil, err
+		}
+		if dlon, i, err = decodeValue(s, i); err != nil {
+			return nil, err
+		}
+		lat += dlat
+		lon += dlon
+		coords = append(coords, mapnik.Coord{X: float64(lon) / 1e5, Y: float64(lat) / 1e5})
+	}
+	return coords, nil
+}
+
+func decodeValue(s string, i int) (int, int, error) {
+	var result, shift uint
+	for {
+		if i >= len(s) {
+			return 0, i, errors.New("staticmap: truncated polyline")
+		}
+		b := uint(s[i]) - 63
+		i++
+		if b > 0x3f {
+			return 0, i, errors.New("staticmap: invalid character in polyline")
+		}
+		result |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			break
+		}
+	}
+	if result&1 != 0 {
+		return int(^(result >> 1)), i, nil
+	}
+	return int(result >> 1), i, nil
+}
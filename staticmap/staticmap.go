@@ -0,0 +1,285 @@
+// Package staticmap renders static map images with markers and paths on top of a Mapnik map.
+//
+// Markers and paths are added as temporary layers with memory datasources. Mapnik places
+// them like any other layer, so labels avoid each other and the markers.
+package staticmap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"sync/atomic"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/internal/style"
+)
+
+// DefaultZoom is used when the map is fitted to a single coordinate.
+const DefaultZoom = 15
+
+// Marker is a point on the map with an optional label.
+type Marker struct {
+	// Lon and Lat of the marker in WGS84.
+	Lon, Lat float64
+	// Icon is the path to a SVG or raster image. Renders a circle with Color if empty.
+	Icon string
+	// Color of the default circle marker. Defaults to red.
+	Color color.NRGBA
+	// Size of the marker in pixel. Defaults to 16.
+	Size float64
+	// Label is placed next to the marker, if space allows.
+	Label string
+}
+
+// Path is a line or polygon on the map.
+type Path struct {
+	// Coords of the path as longitude/latitude pairs in WGS84.
+	Coords []mapnik.Coord
+	// Polyline is an encoded polyline. Used if Coords is empty.
+	Polyline string
+	// Color of the line. Defaults to blue.
+	Color color.NRGBA
+	// Width of the line in pixel. Defaults to 3.
+	Width float64
+	// Fill color of polygons.
+	Fill color.NRGBA
+	// Polygon closes the path and fills it with Fill.
+	Polygon bool
+}
+
+// BBox is a bounding box in WGS84.
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// Options defines the static map.
+type Options struct {
+	// Width and Height of the image in pixel.
+	Width, Height int
+	// Center and Zoom position the map. Used if Center is set.
+	Center *mapnik.Coord
+	Zoom   int
+	// BBox positions the map. Used if Center is not set.
+	BBox *BBox
+	// Padding in pixel around markers and paths if the map is fitted to them,
+	// i.e. neither Center nor BBox is set.
+	Padding int
+
+	Markers []Marker
+	Paths   []Path
+
+	// FontFace of the marker labels. Defaults to "DejaVu Sans Book".
+	FontFace string
+
+	// RenderOpts for the final image.
+	RenderOpts mapnik.RenderOpts
+}
+
+var renderCount uint64
+
+// Render adds the markers and paths of opts to m, renders the map and removes them again.
+// The map is resized and zoomed as defined by opts.
+func Render(m *mapnik.Map, opts Options) ([]byte, error) {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		return nil, errors.New("staticmap: invalid image size")
+	}
+	paths := make([][]mapnik.Coord, len(opts.Paths))
+	for i, p := range opts.Paths {
+		paths[i] = p.Coords
+		if len(paths[i]) == 0 && p.Polyline != "" {
+			coords, err := DecodePolyline(p.Polyline)
+			if err != nil {
+				return nil, err
+			}
+			paths[i] = coords
+		}
+	}
+
+	m.Resize(opts.Width, opts.Height)
+	if err := zoom(m, opts, paths); err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("staticmap-%d", atomic.AddUint64(&renderCount, 1))
+	o := newOverlay(prefix, opts, paths)
+	defer func() {
+		for _, name := range []string{prefix + "-paths", prefix + "-markers"} {
+			m.RemoveLayer(name)
+			m.RemoveStyle(name)
+		}
+		m.RemoveStyle(prefix + "-labels")
+	}()
+	if err := m.LoadString(o.styles, ""); err != nil {
+		return nil, err
+	}
+	if err := addLayer(m, prefix+"-paths", o.paths, prefix+"-paths"); err != nil {
+		return nil, err
+	}
+	markerStyles := []string{prefix + "-markers"}
+	if o.labels {
+		// separate style, so that all markers are placed before the labels
+		markerStyles = append(markerStyles, prefix+"-labels")
+	}
+	if err := addLayer(m, prefix+"-markers", o.markers, markerStyles...); err != nil {
+		return nil, err
+	}
+	return m.Render(opts.RenderOpts)
+}
+
+func zoom(m *mapnik.Map, opts Options, paths [][]mapnik.Coord) error {
+	if opts.Center != nil {
+		return m.ZoomToZoomLevel(opts.Center.X, opts.Center.Y, opts.Zoom)
+	}
+
+	padding := 0
+	bbox := opts.BBox
+	if bbox == nil {
+		bbox = overlayBBox(opts.Markers, paths)
+		if bbox == nil {
+			return errors.New("staticmap: neither center, bbox, markers nor paths defined")
+		}
+		padding = opts.Padding
+	}
+	if bbox.MinLon == bbox.MaxLon && bbox.MinLat == bbox.MaxLat {
+		return m.ZoomToZoomLevel(bbox.MinLon, bbox.MinLat, DefaultZoom)
+	}
+
+	return m.ZoomToLonLat(bbox.MinLon, bbox.MinLat, bbox.MaxLon, bbox.MaxLat, padding)
+}
+
+func overlayBBox(markers []Marker, paths [][]mapnik.Coord) *BBox {
+	var bbox *BBox
+	extend := func(lon, lat float64) {
+		if bbox == nil {
+			bbox = &BBox{lon, lat, lon, lat}
+			return
+		}
+		bbox.MinLon = math.Min(bbox.MinLon, lon)
+		bbox.MinLat = math.Min(bbox.MinLat, lat)
+		bbox.MaxLon = math.Max(bbox.MaxLon, lon)
+		bbox.MaxLat = math.Max(bbox.MaxLat, lat)
+	}
+	for _, mk := range markers {
+		extend(mk.Lon, mk.Lat)
+	}
+	for _, p := range paths {
+		for _, c := range p {
+			extend(c.X, c.Y)
+		}
+	}
+	return bbox
+}
+
+// overlay holds the styles and features of the temporary layers.
+type overlay struct {
+	styles         string
+	paths, markers []mapnik.Feature
+	labels         bool
+}
+
+func newOverlay(prefix string, opts Options, paths [][]mapnik.Coord) *overlay {
+	o := &overlay{}
+	buf := &bytes.Buffer{}
+	buf.WriteString("<Map>\n")
+
+	fmt.Fprintf(buf, "<Style name=\"%s-paths\">\n", prefix)
+	for i, p := range opts.Paths {
+		if len(paths[i]) < 2 {
+			continue
+		}
+		var geom mapnik.Geometry = mapnik.LineString(paths[i])
+		if p.Polygon {
+			ring := paths[i]
+			if ring[0] != ring[len(ring)-1] {
+				ring = append(ring[:len(ring):len(ring)], ring[0])
+			}
+			geom = mapnik.Polygon{ring}
+		}
+		o.paths = append(o.paths, mapnik.Feature{
+			Geometry:   geom,
+			Properties: map[string]interface{}{"sm_id": i},
+		})
+
+		fmt.Fprintf(buf, "<Rule><Filter>[sm_id] = %d</Filter>\n", i)
+		if p.Polygon && p.Fill.A > 0 {
+			fmt.Fprintf(buf, "<PolygonSymbolizer fill=\"%s\" />\n", style.RGBA(p.Fill))
+		}
+		fmt.Fprintf(buf, "<LineSymbolizer stroke=\"%s\" stroke-width=\"%g\" stroke-linejoin=\"round\" stroke-linecap=\"round\" />\n",
+			style.RGBA(orDefault(p.Color, color.NRGBA{0, 0, 255, 255})), orDefaultFloat(p.Width, 3))
+		buf.WriteString("</Rule>\n")
+	}
+	buf.WriteString("</Style>\n")
+
+	fmt.Fprintf(buf, "<Style name=\"%s-markers\">\n", prefix)
+	for i, mk := range opts.Markers {
+		o.markers = append(o.markers, mapnik.Feature{
+			Geometry:   mapnik.Point{X: mk.Lon, Y: mk.Lat},
+			Properties: map[string]interface{}{"sm_id": i, "sm_label": mk.Label},
+		})
+		if mk.Label != "" {
+			o.labels = true
+		}
+
+		size := orDefaultFloat(mk.Size, 16)
+		fmt.Fprintf(buf, "<Rule><Filter>[sm_id] = %d</Filter>\n", i)
+		if mk.Icon != "" {
+			fmt.Fprintf(buf, "<MarkersSymbolizer file=\"%s\" width=\"%g\" allow-overlap=\"true\" />\n",
+				style.Escape(mk.Icon), size)
+		} else {
+			fmt.Fprintf(buf, "<MarkersSymbolizer fill=\"%s\" stroke=\"white\" stroke-width=\"1.5\" width=\"%g\" height=\"%g\" allow-overlap=\"true\" />\n",
+				style.RGBA(orDefault(mk.Color, color.NRGBA{255, 0, 0, 255})), size, size)
+		}
+		buf.WriteString("</Rule>\n")
+	}
+	buf.WriteString("</Style>\n")
+
+	if o.labels {
+		face := opts.FontFace
+		if face == "" {
+			face = "DejaVu Sans Book"
+		}
+		fmt.Fprintf(buf, "<Style name=\"%s-labels\"><Rule><Filter>[sm_label] != ''</Filter>\n", prefix)
+		fmt.Fprintf(buf, "<TextSymbolizer face-name=\"%s\" size=\"11\" fill=\"black\" halo-fill=\"white\" halo-radius=\"1.5\" placement-type=\"simple\" placements=\"N,S,E,W,NE,SE,NW,SW\" dy=\"10\" dx=\"10\">[sm_label]</TextSymbolizer>\n",
+			style.Escape(face))
+		buf.WriteString("</Rule></Style>\n")
+	}
+
+	buf.WriteString("</Map>\n")
+	o.styles = buf.String()
+	return o
+}
+
+func addLayer(m *mapnik.Map, name string, features []mapnik.Feature, styles ...string) error {
+	if len(features) == 0 {
+		return nil
+	}
+	ds, err := mapnik.NewMemoryDatasource(features)
+	if err != nil {
+		return err
+	}
+	defer ds.Free()
+	l := mapnik.NewLayer(name, mapnik.WGS84)
+	defer l.Free()
+	for _, s := range styles {
+		l.AddStyle(s)
+	}
+	l.SetDatasource(ds)
+	m.AddLayer(l)
+	return nil
+}
+
+func orDefault(c, def color.NRGBA) color.NRGBA {
+	if c == (color.NRGBA{}) {
+		return def
+	}
+	return c
+}
+
+func orDefaultFloat(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
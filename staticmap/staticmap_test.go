@@ -0,0 +1,80 @@
+package staticmap
+
+import (
+	"bytes"
+	"image"
+	_ "image/png"
+	"math"
+	"testing"
+
+	"github.com/sgelb/go-mapnik"
+)
+
+func TestDecodePolyline(t *testing.T) {
+	coords, err := DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []mapnik.Coord{{X: -120.2, Y: 38.5}, {X: -120.95, Y: 40.7}, {X: -126.453, Y: 43.252}}
+	if len(coords) != len(expected) {
+		t.Fatal("unexpected coords", coords)
+	}
+	for i := range expected {
+		if math.Abs(coords[i].X-expected[i].X) > 1e-9 || math.Abs(coords[i].Y-expected[i].Y) > 1e-9 {
+			t.Error("unexpected coord", i, coords[i], expected[i])
+		}
+	}
+
+	if _, err := DecodePolyline("_p~iF~ps|U_"); err == nil {
+		t.Error("truncated polyline did not return an error")
+	}
+}
+
+func TestRender(t *testing.T) {
+	m := mapnik.New()
+	if err := m.Load("../test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	layers := m.CountLayers()
+
+	opts := Options{
+		Width:   300,
+		Height:  200,
+		Padding: 20,
+		Markers: []Marker{
+			{Lon: 5, Lat: 50, Label: "A"},
+			{Lon: 11, Lat: 53, Label: "B"},
+		},
+		Paths: []Path{
+			{Coords: []mapnik.Coord{{X: 5, Y: 50}, {X: 8, Y: 52}, {X: 11, Y: 53}}},
+			{Coords: []mapnik.Coord{{X: 6, Y: 50}, {X: 7, Y: 51}, {X: 8, Y: 50}}, Polygon: true},
+		},
+		RenderOpts: mapnik.RenderOpts{Format: "png32"},
+	}
+	b, err := Render(m, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 300 || img.Bounds().Dy() != 200 {
+		t.Error("unexpected size of output image: ", img.Bounds())
+	}
+	if m.CountLayers() != layers {
+		t.Error("temporary layers not removed", m.CountLayers())
+	}
+
+	minx, miny, maxx, maxy := m.CurrentExtent()
+	if minx > 5 || miny > 50 || maxx < 11 || maxy < 53 {
+		t.Error("markers outside of map extent", minx, miny, maxx, maxy)
+	}
+}
+
+func TestRenderWithoutPosition(t *testing.T) {
+	m := mapnik.New()
+	if _, err := Render(m, Options{Width: 100, Height: 100}); err == nil {
+		t.Error("missing position did not return an error")
+	}
+}
@@ -0,0 +1,164 @@
+package mapnik
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// maxIncludeDepth limits nested includes of templates.
+const maxIncludeDepth = 10
+
+// LoadTemplate executes the stylesheet path as a text/template with vars as data and loads
+// the resulting XML like Load. Relative paths in the stylesheet are resolved from the
+// directory of path.
+//
+// Besides the text/template builtins, templates can use:
+//
+//	include "file" [data]  the result of the template file relative to the current template,
+//	                       with data or vars
+//	xml s                  s escaped for XML attributes and text
+//	rgba r g b a           the color rgba(r, g, b, a)
+//	lighten f c            the color c mixed with f (0-1) white, e.g. {{"#336699" | lighten 0.2}}
+//	darken f c             the color c mixed with f (0-1) black
+//	fade a c               the color c with the alpha a (0-1)
+//	zoomscale z            the scale denominator of web mercator tiles at zoom level z
+//	maxscale z             a MaxScaleDenominator for rules that start at zoom level z
+//	minscale z             a MinScaleDenominator for rules that end at zoom level z
+//
+// Colors are hex colors like #369, #336699 or #336699cc.
+func (m *Map) LoadTemplate(path string, vars interface{}) error {
+	s, err := ExecuteTemplate(path, vars)
+	if err != nil {
+		return err
+	}
+	return m.LoadString(s, filepath.Dir(path))
+}
+
+// ExecuteTemplate returns the stylesheet generated by LoadTemplate, e.g. to check or to save
+// it.
+func ExecuteTemplate(path string, vars interface{}) (string, error) {
+	s, err := executeTemplate(path, vars, vars, 0)
+	if err != nil {
+		return "", errors.New("mapnik: " + err.Error())
+	}
+	return s, nil
+}
+
+func executeTemplate(path string, data, vars interface{}, depth int) (string, error) {
+	dir := filepath.Dir(path)
+	funcs := template.FuncMap{
+		"include": func(name string, data ...interface{}) (string, error) {
+			if depth >= maxIncludeDepth {
+				return "", fmt.Errorf("includes nested deeper than %d", maxIncludeDepth)
+			}
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(dir, name)
+			}
+			if len(data) > 0 {
+				return executeTemplate(name, data[0], vars, depth+1)
+			}
+			return executeTemplate(name, vars, vars, depth+1)
+		},
+	}
+	for name, fn := range templateFuncs {
+		funcs[name] = fn
+	}
+	t, err := template.New(filepath.Base(path)).Funcs(funcs).Option("missingkey=error").ParseFiles(path)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+var templateFuncs = template.FuncMap{
+	"xml": func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	},
+	"rgba": func(r, g, b uint8, a float64) string {
+		return formatColor(color.NRGBA{r, g, b, uint8(math.Round(clamp01(a) * 255))})
+	},
+	"lighten": func(f float64, s string) (string, error) {
+		return mixColor(s, color.NRGBA{255, 255, 255, 255}, f)
+	},
+	"darken": func(f float64, s string) (string, error) {
+		return mixColor(s, color.NRGBA{0, 0, 0, 255}, f)
+	},
+	"fade": func(a float64, s string) (string, error) {
+		c, err := parseHexColor(s)
+		if err != nil {
+			return "", err
+		}
+		c.A = uint8(math.Round(clamp01(a) * 255))
+		return formatColor(c), nil
+	},
+	"zoomscale": func(z int) string {
+		return formatScale(ZoomScaleDenominator(z))
+	},
+	// the scale denominators between zoom levels are the geometric means of their neighbours
+	"maxscale": func(z int) string {
+		return formatScale(ZoomScaleDenominator(z) * math.Sqrt2)
+	},
+	"minscale": func(z int) string {
+		return formatScale(ZoomScaleDenominator(z) / math.Sqrt2)
+	},
+}
+
+func formatScale(s float64) string {
+	return strconv.FormatFloat(math.Round(s), 'f', -1, 64)
+}
+
+func clamp01(f float64) float64 {
+	return math.Max(0, math.Min(1, f))
+}
+
+// mixColor mixes the color s with f (0-1) of c, keeping the alpha of s.
+func mixColor(s string, c color.NRGBA, f float64) (string, error) {
+	r, err := parseHexColor(s)
+	if err != nil {
+		return "", err
+	}
+	f = clamp01(f)
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-f) + float64(b)*f))
+	}
+	return formatColor(color.NRGBA{mix(r.R, c.R), mix(r.G, c.G), mix(r.B, c.B), r.A}), nil
+}
+
+// parseHexColor parses colors like #369, #336699 or #336699cc.
+func parseHexColor(s string) (color.NRGBA, error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	if len(h) == 6 {
+		h += "ff"
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if len(h) != 8 || !strings.HasPrefix(s, "#") || err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// formatColor formats opaque colors as #rrggbb and others as rgba(r, g, b, a).
+func formatColor(c color.NRGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	a := strconv.FormatFloat(math.Round(float64(c.A)/255*1000)/1000, 'f', -1, 64)
+	return fmt.Sprintf("rgba(%d, %d, %d, %s)", c.R, c.G, c.B, a)
+}
@@ -0,0 +1,79 @@
+package mapnik
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, s := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"map.xml":   `<Map background-color="{{.bg | lighten 0.5}}">{{include "style.xml"}}{{include "layer.xml" "roads"}}</Map>`,
+		"style.xml": `<Style name="{{xml .name}}"><Rule><MaxScaleDenominator>{{maxscale 10}}</MaxScaleDenominator><LineSymbolizer stroke="{{fade 0.5 .bg}}"/></Rule></Style>`,
+		"layer.xml": `<Layer name="{{.}}"/>`,
+		"loop.xml":  `{{include "loop.xml"}}`,
+	})
+	s, err := ExecuteTemplate(filepath.Join(dir, "map.xml"), map[string]interface{}{"bg": "#369", "name": `a&"b"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<Map background-color="#99b3cc"><Style name="a&amp;&#34;b&#34;"><Rule><MaxScaleDenominator>772131</MaxScaleDenominator>` +
+		`<LineSymbolizer stroke="rgba(51, 102, 153, 0.502)"/></Rule></Style><Layer name="roads"/></Map>`
+	if s != expected {
+		t.Errorf("expected %s, got %s", expected, s)
+	}
+
+	if _, err := ExecuteTemplate(filepath.Join(dir, "loop.xml"), nil); err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Error("recursive include did not return an error", err)
+	}
+	if _, err := ExecuteTemplate(filepath.Join(dir, "map.xml"), map[string]interface{}{"bg": "red"}); err == nil {
+		t.Error("invalid color did not return an error")
+	}
+	if _, err := ExecuteTemplate(filepath.Join(dir, "missing.xml"), nil); err == nil {
+		t.Error("missing template did not return an error")
+	}
+}
+
+func TestTemplateColors(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"#369", "#336699"},
+		{"#336699", "#336699"},
+		{"#33669980", "rgba(51, 102, 153, 0.502)"},
+	}
+	for _, tt := range tests {
+		c, err := parseHexColor(tt.in)
+		if err != nil || formatColor(c) != tt.out {
+			t.Errorf("%s: expected %s, got %s %v", tt.in, tt.out, formatColor(c), err)
+		}
+	}
+	for _, s := range []string{"336699", "#3366", "#xyz", "red"} {
+		if _, err := parseHexColor(s); err == nil {
+			t.Error("no error for", s)
+		}
+	}
+}
+
+func TestLoadTemplate(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"map.xml": `<Map background-color="{{.bg}}" srs="{{.srs}}"/>`,
+	})
+	m := New()
+	defer m.Free()
+	if err := m.LoadTemplate(filepath.Join(dir, "map.xml"), map[string]string{"bg": "#336699", "srs": "+init=epsg:3857"}); err != nil {
+		t.Fatal(err)
+	}
+	if srs := m.SRS(); srs != "+init=epsg:3857" {
+		t.Error("unexpected srs", srs)
+	}
+}
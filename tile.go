@@ -0,0 +1,160 @@
+package mapnik
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// WebMercator is the projection of web map tiles (EPSG:3857).
+const WebMercator = "+proj=merc +a=6378137 +b=6378137 +lat_ts=0.0 +lon_0=0.0 +x_0=0.0 +y_0=0.0 +k=1.0 +units=m +nadgrids=@null +wktext +no_defs +over"
+
+// WGS84 is the projection of longitude and latitude in degrees (EPSG:4326).
+const WGS84 = "+proj=longlat +ellps=WGS84 +datum=WGS84 +no_defs"
+
+// MaxLat is the latitude at the northern edge of the web mercator world.
+const MaxLat = 85.0511287798
+
+// webMercatorMax is the maximum x and y of the web mercator world in meters.
+const webMercatorMax = 6378137 * math.Pi
+
+// TileBBox returns the bounding box of the tile z/x/y in web mercator meters. y counts from
+// the north like in XYZ tile URLs.
+func TileBBox(z, x, y int) (minx, miny, maxx, maxy float64) {
+	size := 2 * webMercatorMax / math.Exp2(float64(z))
+	minx = -webMercatorMax + float64(x)*size
+	maxy = webMercatorMax - float64(y)*size
+	return minx, maxy - size, minx + size, maxy
+}
+
+// TileLonLatBBox returns the bounding box of the tile z/x/y in degrees.
+func TileLonLatBBox(z, x, y int) (minLon, minLat, maxLon, maxLat float64) {
+	minx, miny, maxx, maxy := TileBBox(z, x, y)
+	min := MercatorToLonLat(Coord{minx, miny})
+	max := MercatorToLonLat(Coord{maxx, maxy})
+	return min.X, min.Y, max.X, max.Y
+}
+
+// LonLatToTile returns the x/y of the tile at zoom level z containing lon/lat.
+func LonLatToTile(lon, lat float64, z int) (x, y int) {
+	n := math.Exp2(float64(z))
+	c := LonLatToMercator(Coord{lon, lat})
+	x = int(math.Floor((c.X + webMercatorMax) / (2 * webMercatorMax) * n))
+	y = int(math.Floor((webMercatorMax - c.Y) / (2 * webMercatorMax) * n))
+	// clamp coordinates at the edges of the world to valid tiles
+	max := int(n) - 1
+	if x < 0 {
+		x = 0
+	} else if x > max {
+		x = max
+	}
+	if y < 0 {
+		y = 0
+	} else if y > max {
+		y = max
+	}
+	return x, y
+}
+
+// LonLatToMercator converts degrees to web mercator meters.
+func LonLatToMercator(c Coord) Coord {
+	lat := math.Max(-MaxLat, math.Min(MaxLat, c.Y))
+	return Coord{
+		c.X * metersPerDegree,
+		math.Log(math.Tan((90+lat)*math.Pi/360)) * 6378137,
+	}
+}
+
+// MercatorToLonLat converts web mercator meters to degrees.
+func MercatorToLonLat(c Coord) Coord {
+	return Coord{
+		c.X / metersPerDegree,
+		math.Atan(math.Sinh(c.Y/6378137)) * 180 / math.Pi,
+	}
+}
+
+// TileSize is the width and height of raster tiles in pixel at a scale factor of 1.
+const TileSize = 256
+
+// RenderTile renders the web mercator tile z/x/y as encoded image. The map is resized to
+// TileSize times the scale factor of opts and rendered in web mercator, see
+// RenderMercatorImage.
+func (m *Map) RenderTile(z, x, y int, opts RenderOpts) ([]byte, error) {
+	var data []byte
+	err := m.withWebMercator(func() (err error) {
+		m.zoomToTile(z, x, y, opts.ScaleFactor)
+		data, err = m.Render(opts)
+		return err
+	})
+	return data, err
+}
+
+// RenderTileImage renders the web mercator tile z/x/y like RenderTile, but returns the image.
+func (m *Map) RenderTileImage(z, x, y int, opts RenderOpts) (*image.NRGBA, error) {
+	var img *image.NRGBA
+	err := m.withWebMercator(func() (err error) {
+		m.zoomToTile(z, x, y, opts.ScaleFactor)
+		img, err = m.RenderImage(opts)
+		return err
+	})
+	return img, err
+}
+
+// RenderMercatorImage renders the web mercator bounding box at the current size of the map.
+// Maps in other projections are rendered in web mercator, so that the image matches web
+// mercator tiles; the maximum extent of the map is converted for the render.
+func (m *Map) RenderMercatorImage(minx, miny, maxx, maxy float64, opts RenderOpts) (*image.NRGBA, error) {
+	var img *image.NRGBA
+	err := m.withWebMercator(func() (err error) {
+		m.ZoomTo(minx, miny, maxx, maxy)
+		img, err = m.RenderImage(opts)
+		return err
+	})
+	return img, err
+}
+
+func (m *Map) zoomToTile(z, x, y int, scaleFactor float64) {
+	size := TileSize
+	if scaleFactor > 0 {
+		size = int(math.Round(TileSize * scaleFactor))
+	}
+	m.Resize(size, size)
+	m.ZoomTo(TileBBox(z, x, y))
+}
+
+// withWebMercator calls fn with the map projection set to WebMercator and restores the
+// projection and the maximum extent afterwards.
+func (m *Map) withWebMercator(fn func() error) error {
+	srs := m.SRS()
+	if isWebMercator(srs) {
+		return fn()
+	}
+	extent, hasExtent := m.MaxExtent()
+	if hasExtent {
+		p, err := m.Projection()
+		if err != nil {
+			return err
+		}
+		b := clampBounds(lonLatBBox(p, extent))
+		p.Free()
+		min, max := LonLatToMercator(Coord{b[0], b[1]}), LonLatToMercator(Coord{b[2], b[3]})
+		m.SetMaxExtent(min.X, min.Y, max.X, max.Y)
+	}
+	m.SetSRS(WebMercator)
+	defer func() {
+		m.SetSRS(srs)
+		if hasExtent {
+			m.SetMaxExtent(extent[0], extent[1], extent[2], extent[3])
+		}
+	}()
+	return fn()
+}
+
+// isWebMercator returns true for common definitions of EPSG:3857.
+func isWebMercator(srs string) bool {
+	switch strings.ToLower(strings.TrimSpace(srs)) {
+	case strings.ToLower(WebMercator), "+init=epsg:3857", "epsg:3857", "+init=epsg:900913", "epsg:900913":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package mapnik
+
+// #include "mapnik_c_api.h"
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxTileJSONZoom is the default maxzoom of TileJSON.
+const maxTileJSONZoom = 30
+
+// ZoomScaleDenominator returns the scale denominator of web mercator tiles with TileSize
+// pixels at zoom level z, with the standard pixel size of 0.28mm used by Mapnik.
+func ZoomScaleDenominator(z int) float64 {
+	return 2 * webMercatorMax / (TileSize * 0.00028) / math.Exp2(float64(z))
+}
+
+// TileJSON is a TileJSON 3.0.0 document, see https://github.com/mapbox/tilejson-spec.
+type TileJSON struct {
+	TileJSON    string     `json:"tilejson"`
+	Tiles       []string   `json:"tiles"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Version     string     `json:"version,omitempty"`
+	Attribution string     `json:"attribution,omitempty"`
+	Scheme      string     `json:"scheme,omitempty"`
+	Bounds      [4]float64 `json:"bounds"`
+	Center      [3]float64 `json:"center"`
+	MinZoom     int        `json:"minzoom"`
+	MaxZoom     int        `json:"maxzoom"`
+}
+
+// TileJSON returns a TileJSON document of the map for the tile URLs, e.g.
+// https://example.com/{z}/{x}/{y}.png.
+//
+// The name, description, attribution, version, bounds, center, minzoom and maxzoom map
+// parameters are used if set. Otherwise the bounds are the maximum extent of the map or the
+// extent of all active layers, and the zoom range covers the scale denominators of the
+// active layers.
+func (m *Map) TileJSON(tiles ...string) (*TileJSON, error) {
+	info, err := m.tileInfo()
+	if err != nil {
+		return nil, err
+	}
+	tj := &TileJSON{
+		TileJSON:    "3.0.0",
+		Tiles:       tiles,
+		Name:        info.name,
+		Description: info.description,
+		Version:     info.version,
+		Attribution: info.attribution,
+		Scheme:      "xyz",
+		Bounds:      info.bounds,
+		Center:      info.center,
+		MinZoom:     info.minZoom,
+		MaxZoom:     info.maxZoom,
+	}
+	if tj.Tiles == nil {
+		tj.Tiles = []string{}
+	}
+	return tj, nil
+}
+
+// tileInfo describes the tiles of a map for TileJSON and WMTS.
+type tileInfo struct {
+	name, description, version, attribution string
+	// bounds in degrees
+	bounds           [4]float64
+	center           [3]float64
+	minZoom, maxZoom int
+}
+
+func (m *Map) tileInfo() (tileInfo, error) {
+	var info tileInfo
+	info.name, _ = m.parameter("name")
+	info.description, _ = m.parameter("description")
+	info.version, _ = m.parameter("version")
+	info.attribution, _ = m.parameter("attribution")
+
+	var err error
+	info.minZoom, info.maxZoom = m.zoomRange()
+	if v, ok := m.parameter("minzoom"); ok {
+		if info.minZoom, err = strconv.Atoi(v); err != nil {
+			return info, fmt.Errorf("mapnik: invalid minzoom parameter %q", v)
+		}
+	}
+	if v, ok := m.parameter("maxzoom"); ok {
+		if info.maxZoom, err = strconv.Atoi(v); err != nil {
+			return info, fmt.Errorf("mapnik: invalid maxzoom parameter %q", v)
+		}
+	}
+
+	if v, ok := m.parameter("bounds"); ok {
+		b, err := parseFloats(v, 4)
+		if err != nil {
+			return info, fmt.Errorf("mapnik: invalid bounds parameter %q", v)
+		}
+		copy(info.bounds[:], b)
+	} else if info.bounds, err = m.lonLatBounds(); err != nil {
+		return info, err
+	}
+
+	if v, ok := m.parameter("center"); ok {
+		c, err := parseFloats(v, 3)
+		if err != nil {
+			return info, fmt.Errorf("mapnik: invalid center parameter %q", v)
+		}
+		copy(info.center[:], c)
+	} else {
+		b := info.bounds
+		info.center = [3]float64{(b[0] + b[2]) / 2, (b[1] + b[3]) / 2, float64(info.minZoom)}
+	}
+	return info, nil
+}
+
+// parseFloats parses n comma separated numbers.
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d numbers", n)
+	}
+	fs := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		fs[i] = f
+	}
+	return fs, nil
+}
+
+// zoomRange returns the zoom levels at which at least one active layer is visible.
+func (m *Map) zoomRange() (minZoom, maxZoom int) {
+	minZoom, maxZoom = -1, -1
+	for z := 0; z <= maxTileJSONZoom; z++ {
+		scale := ZoomScaleDenominator(z)
+		for i := 0; i < m.CountLayers(); i++ {
+			if m.layerVisible(i, scale) {
+				if minZoom < 0 {
+					minZoom = z
+				}
+				maxZoom = z
+				break
+			}
+		}
+	}
+	if minZoom < 0 {
+		return 0, maxTileJSONZoom
+	}
+	return minZoom, maxZoom
+}
+
+// lonLatBounds returns the maximum extent of the map, or the extent of all active layers,
+// in degrees and limited to the web mercator world.
+func (m *Map) lonLatBounds() ([4]float64, error) {
+	world := [4]float64{-180, -MaxLat, 180, MaxLat}
+	if extent, ok := m.MaxExtent(); ok {
+		p, err := m.Projection()
+		if err != nil {
+			return world, err
+		}
+		defer p.Free()
+		return clampBounds(lonLatBBox(p, extent)), nil
+	}
+
+	bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for i := 0; i < m.CountLayers(); i++ {
+		if C.mapnik_map_layer_is_active(m.m, C.size_t(i)) == 0 {
+			continue
+		}
+		extent, ok, err := m.layerEnvelope(i)
+		if err != nil {
+			return world, err
+		} else if !ok {
+			continue
+		}
+		p, err := NewProjection(m.layerSRS(i))
+		if err != nil {
+			return world, err
+		}
+		b := lonLatBBox(p, extent)
+		p.Free()
+		bounds[0], bounds[1] = math.Min(bounds[0], b[0]), math.Min(bounds[1], b[1])
+		bounds[2], bounds[3] = math.Max(bounds[2], b[2]), math.Max(bounds[3], b[3])
+	}
+	if bounds[0] > bounds[2] {
+		return world, nil
+	}
+	return clampBounds(bounds), nil
+}
+
+// lonLatBBox transforms the bounding box into degrees. The edges are densified, as straight
+// edges may be curved in the other projection.
+func lonLatBBox(p *Projection, bbox [4]float64) [4]float64 {
+	const n = 20
+	r := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	add := func(x, y float64) {
+		c := p.Inverse(Coord{x, y})
+		r[0], r[1] = math.Min(r[0], c.X), math.Min(r[1], c.Y)
+		r[2], r[3] = math.Max(r[2], c.X), math.Max(r[3], c.Y)
+	}
+	for i := 0; i <= n; i++ {
+		x := bbox[0] + (bbox[2]-bbox[0])*float64(i)/n
+		y := bbox[1] + (bbox[3]-bbox[1])*float64(i)/n
+		add(x, bbox[1])
+		add(x, bbox[3])
+		add(bbox[0], y)
+		add(bbox[2], y)
+	}
+	return r
+}
+
+func clampBounds(b [4]float64) [4]float64 {
+	return [4]float64{
+		math.Max(b[0], -180), math.Max(b[1], -MaxLat),
+		math.Min(b[2], 180), math.Min(b[3], MaxLat),
+	}
+}
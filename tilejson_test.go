@@ -0,0 +1,103 @@
+package mapnik
+
+import (
+	"encoding/xml"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestZoomScaleDenominator(t *testing.T) {
+	if s := ZoomScaleDenominator(0); math.Abs(s-559082264.0287178) > 1e-6 {
+		t.Error("unexpected scale denominator", s)
+	}
+	if s := ZoomScaleDenominator(10); math.Abs(s-545978.7734655447) > 1e-6 {
+		t.Error("unexpected scale denominator", s)
+	}
+}
+
+func TestTileJSON(t *testing.T) {
+	m := New()
+	defer m.Free()
+	if err := m.Load("test/map.xml"); err != nil {
+		t.Fatal(err)
+	}
+	tj, err := m.TileJSON("https://example.com/{z}/{x}/{y}.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bounds from the maximum extent, limited to the web mercator world
+	if tj.Bounds != [4]float64{-180, -MaxLat, 180, MaxLat} || tj.Center != [3]float64{0, 0, 0} {
+		t.Error("unexpected bounds", tj.Bounds, tj.Center)
+	}
+	if tj.TileJSON != "3.0.0" || len(tj.Tiles) != 1 || tj.MinZoom != 0 || tj.MaxZoom != 30 {
+		t.Error("unexpected TileJSON", tj)
+	}
+
+	err = m.LoadString(`<Map srs="+init=epsg:3857">
+		<Parameters>
+			<Parameter name="name">Test</Parameter>
+			<Parameter name="attribution">© Test</Parameter>
+		</Parameters>
+		<Layer name="a" srs="+init=epsg:4326" maximum-scale-denominator="600000000" minimum-scale-denominator="130000">
+			<Datasource>
+				<Parameter name="file">map.geojson</Parameter>
+				<Parameter name="type">geojson</Parameter>
+			</Datasource>
+		</Layer>
+	</Map>`, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tj, err = m.TileJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bounds from the layer extent, zoom levels from the scale denominators of the layer
+	for i, v := range [4]float64{4, 49, 12, 54} {
+		if math.Abs(tj.Bounds[i]-v) > 1e-6 {
+			t.Error("unexpected bounds", tj.Bounds)
+		}
+	}
+	if tj.Name != "Test" || tj.Attribution != "© Test" || tj.MinZoom != 0 || tj.MaxZoom != 12 {
+		t.Error("unexpected TileJSON", tj)
+	}
+}
+
+func TestWMTSCapabilities(t *testing.T) {
+	info := tileInfo{
+		name:        "Test",
+		attribution: "© Test",
+		bounds:      [4]float64{-180, -MaxLat, -1, MaxLat},
+		minZoom:     1,
+		maxZoom:     2,
+	}
+	b, err := wmtsCapabilitiesXML(info, WMTSOptions{URL: "https://example.com/{TileMatrix}/{TileCol}/{TileRow}.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<ows:Identifier>Test</ows:Identifier>`,
+		`<ows:AccessConstraints>© Test</ows:AccessConstraints>`,
+		`<ows:LowerCorner>-180 -85.0511287798</ows:LowerCorner>`,
+		`template="https://example.com/{TileMatrix}/{TileCol}/{TileRow}.png"`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("%s not found in %s", s, b)
+		}
+	}
+
+	var c wmtsCapabilities
+	if err := xml.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+	tms := c.TileMatrixSet.TileMatrix
+	if len(tms) != 3 || tms[2].MatrixWidth != 4 || tms[2].TopLeftCorner != "-20037508.342789244 20037508.342789244" {
+		t.Error("unexpected tile matrices", tms)
+	}
+	// the western half of the world
+	limits := c.Layer.Limits
+	if len(limits) != 2 || limits[1] != (wmtsTileMatrixLimits{"2", 0, 3, 0, 1}) {
+		t.Error("unexpected limits", limits)
+	}
+}
@@ -0,0 +1,41 @@
+package tileserver
+
+import "sync"
+
+// flight is the result of a render that is shared by all callers.
+type flight struct {
+	done  chan struct{}
+	tiles map[string][]byte
+	err   error
+}
+
+// group coalesces concurrent renders of the same key into a single render.
+type group struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// do starts fn, unless a render of key is already running, and returns the shared flight.
+// The result is available when the done channel of the flight is closed.
+func (g *group) do(key string, fn func() (map[string][]byte, error)) *flight {
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		return f
+	}
+	if g.flights == nil {
+		g.flights = map[string]*flight{}
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	go func() {
+		f.tiles, f.err = fn()
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
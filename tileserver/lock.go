@@ -0,0 +1,108 @@
+package tileserver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Locker serializes renders of the same metatile, e.g. across multiple server processes
+// sharing a tile cache. Concurrent renders within one Server are always coalesced.
+type Locker interface {
+	// Lock blocks until the lock for key is acquired and returns a function to release it.
+	Lock(key string) (unlock func(), err error)
+}
+
+// FileLocker locks with lock files in a directory shared by all processes.
+type FileLocker struct {
+	Dir string
+	// Timeout after which locks are considered abandoned, e.g. by a crashed process,
+	// and are removed. Held locks are refreshed every third of the timeout. Defaults to
+	// one minute.
+	Timeout time.Duration
+	// Poll is the interval to check a held lock. Defaults to 50ms.
+	Poll time.Duration
+}
+
+// staleCount makes the names of removed stale locks unique.
+var staleCount uint64
+
+// Lock creates the lock file of key, waiting while it exists. The modification time of the
+// lock file is refreshed until it is unlocked, so that long renders keep their lock.
+func (l *FileLocker) Lock(key string) (func(), error) {
+	timeout, poll := l.Timeout, l.Poll
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	if poll <= 0 {
+		poll = 50 * time.Millisecond
+	}
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key))
+	path := filepath.Join(l.Dir, hex.EncodeToString(sum[:])+".lock")
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return refresh(path, timeout/3), nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > timeout {
+			removeStale(path, timeout)
+			continue
+		}
+		time.Sleep(poll)
+	}
+}
+
+// refresh renews the modification time of the lock file every interval and returns the
+// function that stops it and removes the lock file.
+func refresh(path string, interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-t.C:
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+			os.Remove(path)
+		})
+	}
+}
+
+// removeStale removes the abandoned lock file. The file is renamed first, so that of several
+// waiting processes only one removes it. If the lock was taken again in the meantime, it is
+// moved back.
+func removeStale(path string, timeout time.Duration) {
+	tmp := fmt.Sprintf("%s.%d-%d.stale", path, os.Getpid(), atomic.AddUint64(&staleCount, 1))
+	if err := os.Rename(path, tmp); err != nil {
+		return
+	}
+	if fi, err := os.Stat(tmp); err == nil && time.Since(fi.ModTime()) <= timeout {
+		// a link fails if yet another lock was created
+		os.Link(tmp, path)
+	}
+	os.Remove(tmp)
+}
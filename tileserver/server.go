@@ -0,0 +1,317 @@
+// Package tileserver serves raster tiles of a map over HTTP. Concurrent requests for tiles of
+// the same metatile share one render, and rendered tiles are stored in an optional tile cache.
+package tileserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/cache"
+)
+
+// ErrInvalidTile is returned for tiles outside of the world or the zoom range.
+var ErrInvalidTile = errors.New("tileserver: invalid tile")
+
+// Options configures a Server.
+type Options struct {
+	// NewMap returns a new Map for the pool of rendering maps.
+	NewMap func() (*mapnik.Map, error)
+	// PoolSize is the number of maps. Defaults to the number of CPUs.
+	PoolSize int
+	// Cache stores rendered tiles. Stale tiles are served while they are rendered again.
+	// Blank and single color tiles are stored once if the cache implements cache.SolidCache.
+	Cache cache.TileCache
+	// MetaTile is the number of tiles in x and y direction that are rendered at once.
+	// Larger metatiles render labels across tile borders more consistently. Must be a power of
+	// two, so that metatiles end at the edge of the world. Defaults to 1.
+	MetaTile int
+	// Locker prevents renders of the same metatile in other processes sharing the cache.
+	Locker Locker
+	// Formats maps file extensions of tile URLs to Mapnik image formats.
+	// Defaults to png: png256, jpg: jpeg85 and webp: webp.
+	Formats map[string]string
+	// MaxZoom is the highest zoom level. Defaults to 20.
+	MaxZoom int
+	// ErrorLog logs errors of background renders of stale tiles. Defaults to the standard
+	// logger of the log package.
+	ErrorLog *log.Logger
+}
+
+// Server renders and caches tiles.
+type Server struct {
+	opts  Options
+	maps  chan *mapnik.Map
+	group group
+}
+
+// New creates the pool of maps and returns a new Server.
+func New(opts Options) (*Server, error) {
+	if opts.NewMap == nil {
+		return nil, errors.New("tileserver: missing NewMap")
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = runtime.NumCPU()
+	}
+	if opts.MetaTile <= 0 {
+		opts.MetaTile = 1
+	}
+	if opts.MetaTile&(opts.MetaTile-1) != 0 {
+		return nil, errors.New("tileserver: MetaTile is not a power of two")
+	}
+	if opts.Formats == nil {
+		opts.Formats = map[string]string{"png": "png256", "jpg": "jpeg85", "webp": "webp"}
+	}
+	if opts.MaxZoom <= 0 {
+		opts.MaxZoom = 20
+	}
+	s := &Server{opts: opts, maps: make(chan *mapnik.Map, opts.PoolSize)}
+	for i := 0; i < opts.PoolSize; i++ {
+		m, err := opts.NewMap()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.maps <- m
+	}
+	return s, nil
+}
+
+// Close frees all maps. Renders must not be running.
+func (s *Server) Close() {
+	for {
+		select {
+		case m := <-s.maps:
+			m.Free()
+		default:
+			return
+		}
+	}
+}
+
+// Tile returns the tile from the cache or renders it. Concurrent calls for tiles of the same
+// metatile wait for a single render. ctx only limits the wait, the render continues for
+// other callers and the cache.
+func (s *Server) Tile(ctx context.Context, k cache.Key) ([]byte, error) {
+	n := 1 << uint(k.Z)
+	if k.Z < 0 || k.Z > s.opts.MaxZoom || k.X < 0 || k.X >= n || k.Y < 0 || k.Y >= n {
+		return nil, ErrInvalidTile
+	}
+	if s.opts.Cache != nil {
+		data, err := s.opts.Cache.Get(k)
+		if err == nil {
+			return data, nil
+		} else if err == cache.ErrStale {
+			// serve the stale tile and refresh the cache in the background
+			f := s.render(k, true)
+			go func() {
+				<-f.done
+				if f.err != nil {
+					s.logf("tileserver: refreshing %s: %v", k, f.err)
+				}
+			}()
+			return data, nil
+		} else if err != cache.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	f := s.render(k, false)
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.tiles[k.String()], nil
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.opts.ErrorLog != nil {
+		s.opts.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// metaTile returns the upper left tile and the size of the metatile containing k.
+func (s *Server) metaTile(k cache.Key) (x, y, size int) {
+	size = s.opts.MetaTile
+	if n := 1 << uint(k.Z); size > n {
+		size = n
+	}
+	return k.X / size * size, k.Y / size * size, size
+}
+
+// render starts or joins the render of the metatile containing k.
+func (s *Server) render(k cache.Key, refresh bool) *flight {
+	mx, my, size := s.metaTile(k)
+	meta := cache.Key{Z: k.Z, X: mx, Y: my, Format: k.Format, Scale: k.Scale}
+	return s.group.do(meta.String(), func() (map[string][]byte, error) {
+		if s.opts.Locker != nil {
+			unlock, err := s.opts.Locker.Lock(meta.String())
+			if err != nil {
+				return nil, err
+			}
+			defer unlock()
+			// another process may have rendered the metatile while we were waiting
+			if tiles := s.cached(meta, size); tiles != nil && !refresh {
+				return tiles, nil
+			}
+		}
+		return s.renderMetaTile(meta, size)
+	})
+}
+
+// cached returns all tiles of the metatile if they are fresh in the cache.
+func (s *Server) cached(meta cache.Key, size int) map[string][]byte {
+	if s.opts.Cache == nil {
+		return nil
+	}
+	tiles := map[string][]byte{}
+	for x := meta.X; x < meta.X+size; x++ {
+		for y := meta.Y; y < meta.Y+size; y++ {
+			k := cache.Key{Z: meta.Z, X: x, Y: y, Format: meta.Format, Scale: meta.Scale}
+			data, err := s.opts.Cache.Get(k)
+			if err != nil {
+				return nil
+			}
+			tiles[k.String()] = data
+		}
+	}
+	return tiles
+}
+
+// renderMetaTile renders the metatile with a map of the pool, splits it into tiles and
+// stores them in the cache.
+func (s *Server) renderMetaTile(meta cache.Key, size int) (map[string][]byte, error) {
+	scale := meta.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	tileSize := int(float64(mapnik.TileSize)*scale + 0.5)
+
+	minx, _, _, maxy := mapnik.TileBBox(meta.Z, meta.X, meta.Y)
+	_, miny, maxx, _ := mapnik.TileBBox(meta.Z, meta.X+size-1, meta.Y+size-1)
+	m := <-s.maps
+	m.Resize(size*tileSize, size*tileSize)
+	img, err := m.RenderMercatorImage(minx, miny, maxx, maxy, mapnik.RenderOpts{ScaleFactor: scale})
+	s.maps <- m
+	if err != nil {
+		return nil, err
+	}
+
+	tiles := map[string][]byte{}
+	// single color tiles are encoded once and shared in caches implementing cache.SolidCache
+	solids := map[color.NRGBA][]byte{}
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			// Encode expects a contiguous image, not a sub image with the stride of the metatile
+			t := image.NewNRGBA(image.Rect(0, 0, tileSize, tileSize))
+			draw.Draw(t, t.Bounds(), img, image.Pt(i*tileSize, j*tileSize), draw.Src)
+			k := cache.Key{Z: meta.Z, X: meta.X + i, Y: meta.Y + j, Format: meta.Format, Scale: meta.Scale}
+			c, solid := mapnik.SolidColor(t)
+			data, ok := solids[c]
+			if !solid || !ok {
+				if data, err = mapnik.Encode(t, meta.Format); err != nil {
+					return nil, err
+				}
+				if solid {
+					solids[c] = data
+				}
+			}
+			if sc, ok := s.opts.Cache.(cache.SolidCache); ok && solid {
+				err = sc.PutSolid(k, c, data)
+			} else if s.opts.Cache != nil {
+				err = s.opts.Cache.Put(k, data)
+			}
+			if err != nil {
+				return nil, err
+			}
+			tiles[k.String()] = data
+		}
+	}
+	return tiles, nil
+}
+
+var contentTypes = map[string]string{
+	"png":  "image/png",
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+}
+
+// ParseTilePath parses a tile path like 12/2200/1343.png or /12/2200/1343@2x.png into the
+// tile key and the file extension.
+func ParseTilePath(path string) (cache.Key, string, error) {
+	var k cache.Key
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 3 {
+		return k, "", fmt.Errorf("tileserver: invalid tile path %q", path)
+	}
+	dot := strings.LastIndexByte(parts[2], '.')
+	if dot < 0 {
+		return k, "", fmt.Errorf("tileserver: invalid tile path %q", path)
+	}
+	ext := parts[2][dot+1:]
+	y := parts[2][:dot]
+	if at := strings.IndexByte(y, '@'); at >= 0 {
+		scale, err := strconv.ParseFloat(strings.TrimSuffix(y[at+1:], "x"), 64)
+		if err != nil || scale <= 0 || scale > 4 {
+			return k, "", fmt.Errorf("tileserver: invalid scale in tile path %q", path)
+		}
+		k.Scale = scale
+		y = y[:at]
+	}
+	var err error
+	if k.Z, err = strconv.Atoi(parts[0]); err == nil {
+		if k.X, err = strconv.Atoi(parts[1]); err == nil {
+			k.Y, err = strconv.Atoi(y)
+		}
+	}
+	if err != nil {
+		return k, "", fmt.Errorf("tileserver: invalid tile path %q", path)
+	}
+	return k, ext, nil
+}
+
+// ServeHTTP serves tiles at /{z}/{x}/{y}[@{scale}x].{ext}. Use http.StripPrefix to
+// serve tiles below a path prefix.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k, ext, err := ParseTilePath(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	format, ok := s.opts.Formats[ext]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	k.Format = format
+
+	data, err := s.Tile(r.Context(), k)
+	if err == ErrInvalidTile {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ct, ok := contentTypes[ext]; ok {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
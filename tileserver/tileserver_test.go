@@ -0,0 +1,214 @@
+package tileserver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sgelb/go-mapnik"
+	"github.com/sgelb/go-mapnik/cache"
+)
+
+func TestGroup(t *testing.T) {
+	var g group
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (map[string][]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return map[string][]byte{"a": []byte("tile")}, nil
+	}
+
+	var wg sync.WaitGroup
+	flights := make([]*flight, 10)
+	for i := range flights {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			flights[i] = g.do("key", fn)
+		}(i)
+	}
+	wg.Wait()
+	close(release)
+	for _, f := range flights {
+		<-f.done
+		if string(f.tiles["a"]) != "tile" {
+			t.Error("unexpected result", f.tiles)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 render, got %d", calls)
+	}
+
+	// a finished flight is not reused
+	<-g.do("key", func() (map[string][]byte, error) { return nil, nil }).done
+	if calls != 1 {
+		t.Errorf("expected 1 render, got %d", calls)
+	}
+}
+
+func TestFileLocker(t *testing.T) {
+	l := &FileLocker{Dir: t.TempDir(), Poll: time.Millisecond}
+	unlock, err := l.Lock("1/0/0.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := l.Lock("1/0/0.png")
+		if err == nil {
+			unlock()
+		}
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("lock acquired twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	// held locks are refreshed, abandoned locks are removed after the timeout
+	l.Timeout = 30 * time.Millisecond
+	unlock, err = l.Lock("held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked = make(chan struct{})
+	go func() {
+		unlock, err := l.Lock("held")
+		if err == nil {
+			unlock()
+		}
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("held lock removed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	sum := sha1.Sum([]byte("abandoned"))
+	path := filepath.Join(l.Dir, hex.EncodeToString(sum[:])+".lock")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = l.Lock("abandoned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if files, _ := ioutil.ReadDir(l.Dir); len(files) != 0 {
+		t.Error("lock files left", len(files))
+	}
+}
+
+func TestParseTilePath(t *testing.T) {
+	tests := []struct {
+		path  string
+		key   cache.Key
+		ext   string
+		valid bool
+	}{
+		{"/12/2200/1343.png", cache.Key{Z: 12, X: 2200, Y: 1343}, "png", true},
+		{"3/4/5@2x.webp", cache.Key{Z: 3, X: 4, Y: 5, Scale: 2}, "webp", true},
+		{"/12/2200.png", cache.Key{}, "", false},
+		{"/12/2200/1343", cache.Key{}, "", false},
+		{"/a/2200/1343.png", cache.Key{}, "", false},
+		{"/1/1/1@0x.png", cache.Key{}, "", false},
+	}
+	for _, tt := range tests {
+		k, ext, err := ParseTilePath(tt.path)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+			continue
+		}
+		if tt.valid && (k != tt.key || ext != tt.ext) {
+			t.Errorf("%s: expected %v %s, got %v %s", tt.path, tt.key, tt.ext, k, ext)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	var maps int32
+	c := cache.NewDisk(t.TempDir(), cache.XYZ, 0)
+	s, err := New(Options{
+		NewMap: func() (*mapnik.Map, error) {
+			atomic.AddInt32(&maps, 1)
+			m := mapnik.New()
+			return m, m.Load("../test/map.xml")
+		},
+		PoolSize: 2,
+		Cache:    c,
+		MetaTile: 2,
+		Locker:   &FileLocker{Dir: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if maps != 2 {
+		t.Errorf("expected 2 maps, got %d", maps)
+	}
+
+	// metatiles of other sizes would run past the edge of the world
+	if _, err := New(Options{NewMap: func() (*mapnik.Map, error) { return mapnik.New(), nil }, MetaTile: 3}); err == nil {
+		t.Error("MetaTile 3 did not return an error")
+	}
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var wg sync.WaitGroup
+	for _, path := range []string{"/1/0/0.png", "/1/1/0.png", "/1/0/1.png", "/1/1/1.png"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp, err := http.Get(ts.URL + path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+				t.Error(path, resp.Status, resp.Header.Get("Content-Type"))
+			}
+		}(path)
+	}
+	wg.Wait()
+
+	// all tiles of the metatile are cached
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			if _, err := c.Get(cache.Key{Z: 1, X: x, Y: y, Format: "png256"}); err != nil {
+				t.Error(x, y, err)
+			}
+		}
+	}
+
+	for _, path := range []string{"/1/2/0.png", "/1/0/0.gif", "/21/0/0.png", "/foo"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Error(path, resp.Status)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package mapnik
+
+// #include "mapnik_c_api.h"
+import "C"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+const (
+	// VectorTileExtent is the extent of rendered vector tiles in tile units.
+	VectorTileExtent = 4096
+	// VectorTileBuffer is the buffer around rendered vector tiles in tile units. Features
+	// are clipped at the buffer, so that lines and polygons continue seamlessly across tiles.
+	VectorTileBuffer = 64
+)
+
+// RenderVectorTile renders the features of all active layers within the web mercator tile z/x/y
+// as Mapbox Vector Tile. Like with raster tiles, layers whose scale denominators exclude zoom
+// level z are skipped. Geometries are reprojected, clipped at the tile buffer and quantized to
+// the tile extent. Layers without features in the tile are omitted. Requires Mapnik 3.
+func (m *Map) RenderVectorTile(z, x, y int) ([]byte, error) {
+	minx, miny, maxx, maxy := TileBBox(z, x, y)
+	size := maxx - minx
+	buf := size * VectorTileBuffer / VectorTileExtent
+	bbox, err := m.mercatorToMapBBox(minx-buf, miny-buf, maxx+buf, maxy+buf)
+	if err != nil {
+		return nil, err
+	}
+
+	toTile := func(c Coord) Coord {
+		return Coord{(c.X - minx) / size * VectorTileExtent, (maxy - c.Y) / size * VectorTileExtent}
+	}
+	scale := ZoomScaleDenominator(z)
+	var layers []VectorTileLayer
+	index := map[string]int{}
+	for i := 0; i < m.CountLayers(); i++ {
+		// skip layers that raster tiles of the zoom level do not show
+		if !m.layerVisible(i, scale) {
+			continue
+		}
+		features, err := m.layerFeatures(i, LayerQuery{BBox: &bbox, SRS: WebMercator})
+		if err != nil {
+			return nil, err
+		}
+		var clipped []Feature
+		for _, f := range features {
+			if f.Geometry == nil {
+				continue
+			}
+			f.Geometry = clipGeometry(transformGeometry(f.Geometry, toTile), -VectorTileBuffer, VectorTileExtent+VectorTileBuffer)
+			if f.Geometry != nil {
+				clipped = append(clipped, f)
+			}
+		}
+		if len(clipped) == 0 {
+			continue
+		}
+
+		// layer names must be unique within a tile
+		name := C.GoString(C.mapnik_map_layer_name(m.m, C.size_t(i)))
+		if j, ok := index[name]; ok {
+			layers[j].Features = append(layers[j].Features, clipped...)
+			continue
+		}
+		index[name] = len(layers)
+		layers = append(layers, VectorTileLayer{Name: name, Extent: VectorTileExtent, Features: clipped})
+	}
+	return EncodeVectorTile(layers), nil
+}
+
+// NewVectorTileDatasource initializes a new Datasource with the features of a layer of the
+// Mapbox Vector Tile z/x/y. The tile may be gzip compressed. Geometries are converted to web
+// mercator, so layers using the datasource need WebMercator as SRS. The datasource is empty if
+// the tile does not contain the layer.
+func NewVectorTileDatasource(data []byte, z, x, y int, layer string) (*Datasource, error) {
+	if len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("mapnik: invalid vector tile: %v", err)
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("mapnik: invalid vector tile: %v", err)
+		}
+	}
+	layers, err := DecodeVectorTile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	minx, _, maxx, maxy := TileBBox(z, x, y)
+	size := maxx - minx
+	var features []Feature
+	for _, l := range layers {
+		if l.Name != layer {
+			continue
+		}
+		extent := float64(l.Extent)
+		fromTile := func(c Coord) Coord {
+			return Coord{minx + c.X/extent*size, maxy - c.Y/extent*size}
+		}
+		for _, f := range l.Features {
+			f.Geometry = transformGeometry(f.Geometry, fromTile)
+			features = append(features, f)
+		}
+	}
+	return NewMemoryDatasource(features)
+}
+
+// mercatorToMapBBox converts a web mercator bounding box into the projection of the map.
+func (m *Map) mercatorToMapBBox(minx, miny, maxx, maxy float64) ([4]float64, error) {
+	p, err := m.Projection()
+	if err != nil {
+		return [4]float64{}, err
+	}
+	defer p.Free()
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, c := range []Coord{{minx, miny}, {minx, maxy}, {maxx, miny}, {maxx, maxy}} {
+		c = p.Forward(MercatorToLonLat(c))
+		bbox[0], bbox[1] = math.Min(bbox[0], c.X), math.Min(bbox[1], c.Y)
+		bbox[2], bbox[3] = math.Max(bbox[2], c.X), math.Max(bbox[3], c.Y)
+	}
+	return bbox, nil
+}
+
+// transformGeometry returns a copy of the geometry with fn applied to all coordinates.
+func transformGeometry(g Geometry, fn func(Coord) Coord) Geometry {
+	coords := func(cs []Coord) []Coord {
+		r := make([]Coord, len(cs))
+		for i, c := range cs {
+			r[i] = fn(c)
+		}
+		return r
+	}
+	polygon := func(p Polygon) Polygon {
+		r := make(Polygon, len(p))
+		for i, ring := range p {
+			r[i] = coords(ring)
+		}
+		return r
+	}
+	switch g := g.(type) {
+	case Point:
+		return Point(fn(Coord(g)))
+	case LineString:
+		return LineString(coords(g))
+	case Polygon:
+		return polygon(g)
+	case MultiPoint:
+		return MultiPoint(coords(g))
+	case MultiLineString:
+		r := make(MultiLineString, len(g))
+		for i, l := range g {
+			r[i] = coords(l)
+		}
+		return r
+	case MultiPolygon:
+		r := make(MultiPolygon, len(g))
+		for i, p := range g {
+			r[i] = polygon(p)
+		}
+		return r
+	case GeometryCollection:
+		r := make(GeometryCollection, len(g))
+		for i, m := range g {
+			r[i] = transformGeometry(m, fn)
+		}
+		return r
+	}
+	return g
+}
+
+// clipGeometry clips the geometry at the square from lo to hi and rounds all coordinates
+// to integers. Returns nil if nothing remains.
+func clipGeometry(g Geometry, lo, hi float64) Geometry {
+	inside := func(c Coord) bool {
+		return c.X >= lo && c.X <= hi && c.Y >= lo && c.Y <= hi
+	}
+	switch g := g.(type) {
+	case Point:
+		if inside(Coord(g)) {
+			return Point(roundCoord(Coord(g)))
+		}
+	case MultiPoint:
+		var mp MultiPoint
+		for _, c := range g {
+			if inside(c) {
+				mp = append(mp, roundCoord(c))
+			}
+		}
+		if len(mp) == 1 {
+			return Point(mp[0])
+		} else if len(mp) > 1 {
+			return mp
+		}
+	case LineString:
+		return lines(clipLine(g, lo, hi))
+	case MultiLineString:
+		var ml MultiLineString
+		for _, l := range g {
+			ml = append(ml, clipLine(l, lo, hi)...)
+		}
+		return lines(ml)
+	case Polygon:
+		if p := clipPolygon(g, lo, hi); p != nil {
+			return p
+		}
+	case MultiPolygon:
+		var mp MultiPolygon
+		for _, p := range g {
+			if p := clipPolygon(p, lo, hi); p != nil {
+				mp = append(mp, p)
+			}
+		}
+		if len(mp) == 1 {
+			return mp[0]
+		} else if len(mp) > 1 {
+			return mp
+		}
+	case GeometryCollection:
+		var gc GeometryCollection
+		for _, m := range g {
+			if m := clipGeometry(m, lo, hi); m != nil {
+				gc = append(gc, m)
+			}
+		}
+		if len(gc) > 0 {
+			return gc
+		}
+	}
+	return nil
+}
+
+func lines(ml MultiLineString) Geometry {
+	if len(ml) == 0 {
+		return nil
+	} else if len(ml) == 1 {
+		return ml[0]
+	}
+	return ml
+}
+
+func roundCoord(c Coord) Coord {
+	return Coord{math.Round(c.X), math.Round(c.Y)}
+}
+
+// roundCoords rounds the coordinates and removes consecutive duplicates.
+func roundCoords(cs []Coord) []Coord {
+	var r []Coord
+	for _, c := range cs {
+		c = roundCoord(c)
+		if len(r) == 0 || r[len(r)-1] != c {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// clipLine clips the line into the parts within the square from lo to hi.
+func clipLine(l LineString, lo, hi float64) MultiLineString {
+	var ml MultiLineString
+	var cur []Coord
+	flush := func() {
+		if cur = roundCoords(cur); len(cur) > 1 {
+			ml = append(ml, cur)
+		}
+		cur = nil
+	}
+	for i := 1; i < len(l); i++ {
+		a, b, ok := clipSegment(l[i-1], l[i], lo, hi)
+		if !ok {
+			flush()
+			continue
+		}
+		if len(cur) > 0 && cur[len(cur)-1] != a {
+			flush()
+		}
+		if len(cur) == 0 {
+			cur = append(cur, a)
+		}
+		cur = append(cur, b)
+	}
+	flush()
+	return ml
+}
+
+// clipSegment clips the segment from a to b with the Liang-Barsky algorithm.
+func clipSegment(a, b Coord, lo, hi float64) (Coord, Coord, bool) {
+	t0, t1 := 0.0, 1.0
+	dx, dy := b.X-a.X, b.Y-a.Y
+	for _, e := range [4][2]float64{{-dx, a.X - lo}, {dx, hi - a.X}, {-dy, a.Y - lo}, {dy, hi - a.Y}} {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return a, b, false
+			}
+			t0 = math.Max(t0, r)
+		} else {
+			if r < t0 {
+				return a, b, false
+			}
+			t1 = math.Min(t1, r)
+		}
+	}
+	return Coord{a.X + t0*dx, a.Y + t0*dy}, Coord{a.X + t1*dx, a.Y + t1*dy}, true
+}
+
+// clipPolygon clips all rings of the polygon. Returns nil if the exterior ring vanishes.
+func clipPolygon(p Polygon, lo, hi float64) Polygon {
+	var r Polygon
+	for i, ring := range p {
+		ring = clipRing(ring, lo, hi)
+		if ring == nil {
+			if i == 0 {
+				return nil
+			}
+			continue
+		}
+		r = append(r, ring)
+	}
+	return r
+}
+
+// clipRing clips the closed ring with the Sutherland-Hodgman algorithm. Returns nil if
+// less than three distinct points or no area remains.
+func clipRing(ring []Coord, lo, hi float64) []Coord {
+	if len(ring) > 1 && ring[0] == ring[len(ring)-1] {
+		ring = ring[:len(ring)-1]
+	}
+	edges := []struct {
+		inside func(Coord) bool
+		cross  func(a, b Coord) Coord
+	}{
+		{func(c Coord) bool { return c.X >= lo }, func(a, b Coord) Coord { return crossX(a, b, lo) }},
+		{func(c Coord) bool { return c.X <= hi }, func(a, b Coord) Coord { return crossX(a, b, hi) }},
+		{func(c Coord) bool { return c.Y >= lo }, func(a, b Coord) Coord { return crossY(a, b, lo) }},
+		{func(c Coord) bool { return c.Y <= hi }, func(a, b Coord) Coord { return crossY(a, b, hi) }},
+	}
+	for _, e := range edges {
+		var out []Coord
+		for i, c := range ring {
+			prev := ring[(i+len(ring)-1)%len(ring)]
+			if e.inside(c) {
+				if !e.inside(prev) {
+					out = append(out, e.cross(prev, c))
+				}
+				out = append(out, c)
+			} else if e.inside(prev) {
+				out = append(out, e.cross(prev, c))
+			}
+		}
+		ring = out
+		if len(ring) == 0 {
+			return nil
+		}
+	}
+
+	ring = roundCoords(ring)
+	if len(ring) > 1 && ring[0] == ring[len(ring)-1] {
+		ring = ring[:len(ring)-1]
+	}
+	if len(ring) < 3 || ringArea(ring) == 0 {
+		return nil
+	}
+	return append(ring, ring[0])
+}
+
+func crossX(a, b Coord, x float64) Coord {
+	return Coord{x, a.Y + (b.Y-a.Y)*(x-a.X)/(b.X-a.X)}
+}
+
+func crossY(a, b Coord, y float64) Coord {
+	return Coord{a.X + (b.X-a.X)*(y-a.Y)/(b.Y-a.Y), y}
+}
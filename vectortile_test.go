@@ -0,0 +1,89 @@
+package mapnik
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTileBBox(t *testing.T) {
+	minx, miny, maxx, maxy := TileBBox(0, 0, 0)
+	assertEqual(t, [4]float64{-webMercatorMax, -webMercatorMax, webMercatorMax, webMercatorMax}, [4]float64{minx, miny, maxx, maxy})
+
+	minx, miny, maxx, maxy = TileBBox(1, 1, 0)
+	assertEqual(t, [4]float64{0, 0, webMercatorMax, webMercatorMax}, [4]float64{minx, miny, maxx, maxy})
+
+	minLon, minLat, maxLon, maxLat := TileLonLatBBox(1, 0, 1)
+	if math.Abs(minLon+180) > 1e-9 || math.Abs(minLat+85.0511287798) > 1e-9 || maxLon != 0 || maxLat != 0 {
+		t.Error("unexpected lon/lat bbox", minLon, minLat, maxLon, maxLat)
+	}
+
+	x, y := LonLatToTile(9.99, 53.55, 10)
+	assertEqual(t, [2]int{540, 330}, [2]int{x, y})
+	x, y = LonLatToTile(180, -90, 2)
+	assertEqual(t, [2]int{3, 3}, [2]int{x, y})
+}
+
+func TestVectorTileRoundTrip(t *testing.T) {
+	layers := []VectorTileLayer{
+		{
+			Name:   "points",
+			Extent: 4096,
+			Features: []Feature{
+				{ID: 1, Geometry: Point{10, 20}, Properties: map[string]interface{}{"name": "a", "rank": int64(-3), "v": 0.5, "ok": true}},
+				{ID: 2, Geometry: MultiPoint{{1, 2}, {3, 4}}, Properties: map[string]interface{}{"name": "a"}},
+			},
+		},
+		{
+			Name:   "shapes",
+			Extent: 512,
+			Features: []Feature{
+				{ID: 3, Geometry: LineString{{0, 0}, {10, 10}, {20, 0}}, Properties: map[string]interface{}{}},
+				{ID: 4, Geometry: MultiLineString{{{0, 0}, {1, 1}}, {{5, 5}, {6, 5}}}, Properties: map[string]interface{}{}},
+				{ID: 5, Geometry: Polygon{
+					{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+					{{2, 2}, {2, 4}, {4, 4}, {4, 2}, {2, 2}},
+				}, Properties: map[string]interface{}{}},
+				{ID: 6, Geometry: MultiPolygon{
+					{{{0, 0}, {10, 0}, {10, 10}, {0, 0}}},
+					{{{20, 20}, {30, 20}, {30, 30}, {20, 20}}},
+				}, Properties: map[string]interface{}{}},
+			},
+		},
+	}
+	actual, err := DecodeVectorTile(EncodeVectorTile(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, layers, actual)
+
+	// exterior rings are clockwise in tile coordinates, holes counter-clockwise
+	p := actual[1].Features[2].Geometry.(Polygon)
+	if ringArea(p[0]) <= 0 || ringArea(p[1]) >= 0 {
+		t.Error("unexpected ring orientation", p)
+	}
+
+	if _, err := DecodeVectorTile([]byte{0x1a, 0x10, 0x0a}); err == nil {
+		t.Error("truncated tile did not return an error")
+	}
+}
+
+func TestClipGeometry(t *testing.T) {
+	tests := []struct {
+		geom, expected Geometry
+	}{
+		{Point{5.4, 5.6}, Point{5, 6}},
+		{Point{-1, 5}, nil},
+		{MultiPoint{{1, 1}, {20, 20}}, Point{1, 1}},
+		{LineString{{-5, 5}, {5, 5}}, LineString{{0, 5}, {5, 5}}},
+		// leaves and reenters the square
+		{LineString{{2, 2}, {2, 15}, {8, 15}, {8, 2}}, MultiLineString{{{2, 2}, {2, 10}}, {{8, 10}, {8, 2}}}},
+		{LineString{{20, 20}, {30, 30}}, nil},
+		{Polygon{{{-5, -5}, {5, -5}, {5, 5}, {-5, 5}, {-5, -5}}}, Polygon{{{0, 0}, {5, 0}, {5, 5}, {0, 5}, {0, 0}}}},
+		{Polygon{{{20, 20}, {30, 20}, {30, 30}, {20, 20}}}, nil},
+		// hole outside of the square
+		{Polygon{{{0, 0}, {30, 0}, {30, 30}, {0, 0}}, {{20, 1}, {21, 1}, {21, 2}, {20, 1}}}, Polygon{{{10, 10}, {0, 0}, {10, 0}, {10, 10}}}},
+	}
+	for _, tt := range tests {
+		assertEqual(t, tt.expected, clipGeometry(tt.geom, 0, 10))
+	}
+}
@@ -0,0 +1,241 @@
+package mapnik
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MarshalWKT encodes the geometry as well-known text.
+func MarshalWKT(g Geometry) string {
+	b := &strings.Builder{}
+	writeWKT(b, g)
+	return b.String()
+}
+
+func writeWKT(b *strings.Builder, g Geometry) {
+	b.WriteString(strings.ToUpper(g.Type()))
+	b.WriteString(" ")
+	switch g := g.(type) {
+	case Point:
+		b.WriteString("(")
+		writeWKTCoord(b, Coord(g))
+		b.WriteString(")")
+	case LineString:
+		writeWKTCoords(b, g)
+	case Polygon:
+		writeWKTRings(b, g)
+	case MultiPoint:
+		writeWKTList(b, len(g), func(i int) {
+			b.WriteString("(")
+			writeWKTCoord(b, g[i])
+			b.WriteString(")")
+		})
+	case MultiLineString:
+		writeWKTList(b, len(g), func(i int) { writeWKTCoords(b, g[i]) })
+	case MultiPolygon:
+		writeWKTList(b, len(g), func(i int) { writeWKTRings(b, g[i]) })
+	case GeometryCollection:
+		writeWKTList(b, len(g), func(i int) { writeWKT(b, g[i]) })
+	}
+}
+
+// writeWKTList writes n comma separated elements in parentheses or EMPTY.
+func writeWKTList(b *strings.Builder, n int, fn func(i int)) {
+	if n == 0 {
+		b.WriteString("EMPTY")
+		return
+	}
+	b.WriteString("(")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fn(i)
+	}
+	b.WriteString(")")
+}
+
+func writeWKTCoord(b *strings.Builder, c Coord) {
+	b.WriteString(strconv.FormatFloat(c.X, 'f', -1, 64))
+	b.WriteString(" ")
+	b.WriteString(strconv.FormatFloat(c.Y, 'f', -1, 64))
+}
+
+func writeWKTCoords(b *strings.Builder, cs []Coord) {
+	writeWKTList(b, len(cs), func(i int) { writeWKTCoord(b, cs[i]) })
+}
+
+func writeWKTRings(b *strings.Builder, rings [][]Coord) {
+	writeWKTList(b, len(rings), func(i int) { writeWKTCoords(b, rings[i]) })
+}
+
+// UnmarshalWKT decodes a geometry from well-known text. Geometries with Z or M values are not supported.
+func UnmarshalWKT(s string) (Geometry, error) {
+	p := &wktParser{s: s}
+	g := p.geometry()
+	if p.err == nil {
+		if tok := p.next(); tok != "" {
+			p.fail("unexpected %q after geometry", tok)
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return g, nil
+}
+
+type wktParser struct {
+	s   string
+	pos int
+	err error
+}
+
+func (p *wktParser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = errors.New("mapnik: invalid WKT: " + fmt.Sprintf(format, args...))
+	}
+}
+
+// next returns the next token: a word, a number or one of '(', ')' and ','.
+func (p *wktParser) next() string {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos >= len(p.s) {
+		return ""
+	}
+	start := p.pos
+	if strings.IndexByte("(),", p.s[p.pos]) >= 0 {
+		p.pos++
+		return p.s[start:p.pos]
+	}
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n(),", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *wktParser) peek() string {
+	pos := p.pos
+	tok := p.next()
+	p.pos = pos
+	return tok
+}
+
+func (p *wktParser) expect(tok string) {
+	if t := p.next(); t != tok && p.err == nil {
+		p.fail("expected %q, got %q", tok, t)
+	}
+}
+
+// empty consumes EMPTY or the opening parenthesis of a non-empty geometry.
+func (p *wktParser) empty() bool {
+	if strings.EqualFold(p.peek(), "EMPTY") {
+		p.next()
+		return true
+	}
+	p.expect("(")
+	return false
+}
+
+// list calls fn for each comma separated element up to the closing parenthesis.
+func (p *wktParser) list(fn func()) {
+	for p.err == nil {
+		fn()
+		if t := p.next(); t == ")" {
+			return
+		} else if t != "," {
+			p.fail("expected \",\" or \")\", got %q", t)
+		}
+	}
+}
+
+func (p *wktParser) number() float64 {
+	tok := p.next()
+	v, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		p.fail("invalid number %q", tok)
+	}
+	return v
+}
+
+func (p *wktParser) coord() Coord {
+	return Coord{p.number(), p.number()}
+}
+
+func (p *wktParser) coords() []Coord {
+	cs := []Coord{}
+	if p.empty() {
+		return cs
+	}
+	p.list(func() { cs = append(cs, p.coord()) })
+	return cs
+}
+
+func (p *wktParser) rings() [][]Coord {
+	rs := [][]Coord{}
+	if p.empty() {
+		return rs
+	}
+	p.list(func() { rs = append(rs, p.coords()) })
+	return rs
+}
+
+func (p *wktParser) geometry() Geometry {
+	typ := strings.ToUpper(p.next())
+	switch typ {
+	case "POINT":
+		if p.empty() {
+			p.fail("empty points are not supported")
+			return nil
+		}
+		c := p.coord()
+		p.expect(")")
+		return Point(c)
+	case "LINESTRING":
+		return LineString(p.coords())
+	case "POLYGON":
+		return Polygon(p.rings())
+	case "MULTIPOINT":
+		mp := MultiPoint{}
+		if p.empty() {
+			return mp
+		}
+		p.list(func() {
+			// points may or may not be enclosed in parentheses
+			if p.peek() == "(" {
+				p.next()
+				mp = append(mp, p.coord())
+				p.expect(")")
+				return
+			}
+			mp = append(mp, p.coord())
+		})
+		return mp
+	case "MULTILINESTRING":
+		ml := MultiLineString{}
+		if p.empty() {
+			return ml
+		}
+		p.list(func() { ml = append(ml, p.coords()) })
+		return ml
+	case "MULTIPOLYGON":
+		mp := MultiPolygon{}
+		if p.empty() {
+			return mp
+		}
+		p.list(func() { mp = append(mp, p.rings()) })
+		return mp
+	case "GEOMETRYCOLLECTION":
+		gc := GeometryCollection{}
+		if p.empty() {
+			return gc
+		}
+		p.list(func() { gc = append(gc, p.geometry()) })
+		return gc
+	}
+	p.fail("unsupported geometry type %q", typ)
+	return nil
+}
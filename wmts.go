@@ -0,0 +1,165 @@
+package mapnik
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+)
+
+// WMTSOptions configures the WMTS capabilities of a map.
+type WMTSOptions struct {
+	// Layer is the identifier of the layer. Defaults to the name parameter of the map or "map".
+	Layer string
+	// URL is the tile URL template with {TileMatrix}, {TileCol} and {TileRow}, e.g.
+	// https://example.com/{TileMatrix}/{TileCol}/{TileRow}.png.
+	URL string
+	// Format is the MIME type of the tiles. Defaults to image/png.
+	Format string
+}
+
+// wmtsTileMatrixSet is the identifier of the web mercator tile matrix set.
+const wmtsTileMatrixSet = "GoogleMapsCompatible"
+
+type wmtsCapabilities struct {
+	XMLName  xml.Name `xml:"Capabilities"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	XmlnsOWS string   `xml:"xmlns:ows,attr"`
+	Version  string   `xml:"version,attr"`
+	Service  struct {
+		Title              string `xml:"ows:Title"`
+		Abstract           string `xml:"ows:Abstract,omitempty"`
+		ServiceType        string `xml:"ows:ServiceType"`
+		ServiceTypeVersion string `xml:"ows:ServiceTypeVersion"`
+		AccessConstraints  string `xml:"ows:AccessConstraints,omitempty"`
+	} `xml:"ows:ServiceIdentification"`
+	Layer struct {
+		Title       string `xml:"ows:Title"`
+		Abstract    string `xml:"ows:Abstract,omitempty"`
+		LowerCorner string `xml:"ows:WGS84BoundingBox>ows:LowerCorner"`
+		UpperCorner string `xml:"ows:WGS84BoundingBox>ows:UpperCorner"`
+		Identifier  string `xml:"ows:Identifier"`
+		Style       struct {
+			IsDefault  bool   `xml:"isDefault,attr"`
+			Identifier string `xml:"ows:Identifier"`
+		}
+		Format        string                 `xml:"Format"`
+		TileMatrixSet string                 `xml:"TileMatrixSetLink>TileMatrixSet"`
+		Limits        []wmtsTileMatrixLimits `xml:"TileMatrixSetLink>TileMatrixSetLimits>TileMatrixLimits"`
+		ResourceURL   struct {
+			Format       string `xml:"format,attr"`
+			ResourceType string `xml:"resourceType,attr"`
+			Template     string `xml:"template,attr"`
+		}
+	} `xml:"Contents>Layer"`
+	TileMatrixSet struct {
+		Identifier        string `xml:"ows:Identifier"`
+		SupportedCRS      string `xml:"ows:SupportedCRS"`
+		WellKnownScaleSet string
+		TileMatrix        []wmtsTileMatrix
+	} `xml:"Contents>TileMatrixSet"`
+}
+
+type wmtsTileMatrix struct {
+	Identifier       string `xml:"ows:Identifier"`
+	ScaleDenominator float64
+	TopLeftCorner    string
+	TileWidth        int
+	TileHeight       int
+	MatrixWidth      int
+	MatrixHeight     int
+}
+
+type wmtsTileMatrixLimits struct {
+	TileMatrix string
+	MinTileRow int
+	MaxTileRow int
+	MinTileCol int
+	MaxTileCol int
+}
+
+// WMTSCapabilities returns a WMTS 1.0.0 GetCapabilities document of the map with a single
+// layer of web mercator tiles. The title, bounds and zoom range are determined like for
+// TileJSON, the description and attribution parameters become the abstract and the access
+// constraints.
+func (m *Map) WMTSCapabilities(opts WMTSOptions) ([]byte, error) {
+	info, err := m.tileInfo()
+	if err != nil {
+		return nil, err
+	}
+	return wmtsCapabilitiesXML(info, opts)
+}
+
+func wmtsCapabilitiesXML(info tileInfo, opts WMTSOptions) ([]byte, error) {
+	if opts.Layer == "" {
+		opts.Layer = info.name
+	}
+	if opts.Layer == "" {
+		opts.Layer = "map"
+	}
+	if opts.Format == "" {
+		opts.Format = "image/png"
+	}
+	title := info.name
+	if title == "" {
+		title = opts.Layer
+	}
+
+	c := wmtsCapabilities{
+		Xmlns:    "http://www.opengis.net/wmts/1.0",
+		XmlnsOWS: "http://www.opengis.net/ows/1.1",
+		Version:  "1.0.0",
+	}
+	c.Service.Title = title
+	c.Service.Abstract = info.description
+	c.Service.ServiceType = "OGC WMTS"
+	c.Service.ServiceTypeVersion = "1.0.0"
+	c.Service.AccessConstraints = info.attribution
+
+	l := &c.Layer
+	l.Title = title
+	l.Abstract = info.description
+	l.LowerCorner = formatCoords(info.bounds[0], info.bounds[1])
+	l.UpperCorner = formatCoords(info.bounds[2], info.bounds[3])
+	l.Identifier = opts.Layer
+	l.Style.IsDefault = true
+	l.Style.Identifier = "default"
+	l.Format = opts.Format
+	l.TileMatrixSet = wmtsTileMatrixSet
+	l.ResourceURL.Format = opts.Format
+	l.ResourceURL.ResourceType = "tile"
+	l.ResourceURL.Template = opts.URL
+
+	// the tile matrix set starts at zoom level 0, the limits restrict it to the map
+	tms := &c.TileMatrixSet
+	tms.Identifier = wmtsTileMatrixSet
+	tms.SupportedCRS = "urn:ogc:def:crs:EPSG::3857"
+	tms.WellKnownScaleSet = "urn:ogc:def:wkss:OGC:1.0:GoogleMapsCompatible"
+	for z := 0; z <= info.maxZoom; z++ {
+		n := int(math.Exp2(float64(z)))
+		tms.TileMatrix = append(tms.TileMatrix, wmtsTileMatrix{
+			Identifier:       strconv.Itoa(z),
+			ScaleDenominator: ZoomScaleDenominator(z),
+			TopLeftCorner:    formatCoords(-webMercatorMax, webMercatorMax),
+			TileWidth:        TileSize,
+			TileHeight:       TileSize,
+			MatrixWidth:      n,
+			MatrixHeight:     n,
+		})
+		if z < info.minZoom {
+			continue
+		}
+		minCol, minRow := LonLatToTile(info.bounds[0], info.bounds[3], z)
+		maxCol, maxRow := LonLatToTile(info.bounds[2], info.bounds[1], z)
+		l.Limits = append(l.Limits, wmtsTileMatrixLimits{strconv.Itoa(z), minRow, maxRow, minCol, maxCol})
+	}
+
+	b, err := xml.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func formatCoords(x, y float64) string {
+	return strconv.FormatFloat(x, 'f', -1, 64) + " " + strconv.FormatFloat(y, 'f', -1, 64)
+}